@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathMapPath returns where the placeholders of -anonymize-paths for the
+// tree at root are kept by default: in the user cache directory, outside the
+// tree, so that the mapping is never collected along with it.
+func pathMapPath(root string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "collect", "paths", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// readPathMap reads the mapping of placeholder paths to real paths written
+// by writePathMap, returning the aliases of a Collector. A missing file is
+// an empty mapping.
+func readPathMap(file string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return aliases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", file, err)
+	}
+	for placeholder, real := range mapping {
+		aliases[real] = path.Base(placeholder)
+	}
+	return aliases, nil
+}
+
+// writePathMap records the placeholder path of every aliased file and
+// directory with its real path, so that answers naming placeholders can be
+// read back.
+func writePathMap(file string, aliases map[string]string) error {
+	mapping := make(map[string]string, len(aliases))
+	for real := range aliases {
+		parts := strings.Split(real, "/")
+		end := 0
+		for i, part := range parts {
+			end += len(part)
+			if alias, ok := aliases[real[:end]]; ok {
+				parts[i] = alias
+			}
+			end++
+		}
+		mapping[strings.Join(parts, "/")] = real
+	}
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0600)
+}
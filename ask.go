@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// askMaxTokens caps the length of the answer to collect ask, which the
+// Anthropic API requires.
+const askMaxTokens = 4096
+
+// askUsage is what the API reports the question and answer cost.
+type askUsage struct {
+	InputTokens, OutputTokens int
+}
+
+// askConfig says where collect ask sends the collection.
+type askConfig struct {
+	provider string
+	endpoint string
+	model    string
+	key      string
+}
+
+// newAskConfig picks the provider from the model name, Claude models going
+// to Anthropic and everything else to an OpenAI-compatible endpoint, and
+// reads its key from the environment. endpoint overrides the provider's URL.
+func newAskConfig(model, endpoint string) (askConfig, error) {
+	cfg := askConfig{provider: "openai", endpoint: "https://api.openai.com/v1/chat/completions", model: model}
+	keyVar := "OPENAI_API_KEY"
+	if strings.HasPrefix(model, "claude") {
+		cfg.provider, cfg.endpoint = "anthropic", "https://api.anthropic.com/v1/messages"
+		keyVar = "ANTHROPIC_API_KEY"
+	}
+	if endpoint != "" {
+		cfg.endpoint = endpoint
+	}
+	cfg.key = os.Getenv(keyVar)
+	// Local OpenAI-compatible servers usually need no key.
+	if cfg.key == "" && endpoint == "" {
+		return cfg, fmt.Errorf("%s is not set", keyVar)
+	}
+	return cfg, nil
+}
+
+// ask sends prompt to the model and streams the answer to w as it arrives.
+func ask(cfg askConfig, prompt string, w io.Writer) (askUsage, error) {
+	messages := []map[string]string{{"role": "user", "content": prompt}}
+	body := map[string]any{"model": cfg.model, "messages": messages, "stream": true}
+	if cfg.provider == "anthropic" {
+		body["max_tokens"] = askMaxTokens
+	} else {
+		body["stream_options"] = map[string]bool{"include_usage": true}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return askUsage{}, err
+	}
+	request, err := http.NewRequest(http.MethodPost, cfg.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return askUsage{}, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if cfg.provider == "anthropic" {
+		request.Header.Set("x-api-key", cfg.key)
+		request.Header.Set("anthropic-version", "2023-06-01")
+	} else if cfg.key != "" {
+		request.Header.Set("Authorization", "Bearer "+cfg.key)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return askUsage{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return askUsage{}, fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	var usage askUsage
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		// The fields of both providers' stream events, of which each
+		// event only fills a few.
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Text string `json:"text"`
+			} `json:"delta"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Usage struct {
+				OutputTokens     int `json:"output_tokens"`
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return usage, fmt.Errorf("reading answer: %w", err)
+		}
+		if event.Error != nil {
+			return usage, fmt.Errorf("%s", event.Error.Message)
+		}
+		switch event.Type {
+		case "message_start":
+			usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			fmt.Fprint(w, event.Delta.Text)
+		case "message_delta":
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "":
+			for _, choice := range event.Choices {
+				fmt.Fprint(w, choice.Delta.Content)
+			}
+			if event.Usage.PromptTokens > 0 {
+				usage.InputTokens, usage.OutputTokens = event.Usage.PromptTokens, event.Usage.CompletionTokens
+			}
+		}
+	}
+	fmt.Fprintln(w)
+	return usage, scanner.Err()
+}
+
+// parsePrice reads -price, the US dollars per million input and output
+// tokens separated by a comma.
+func parsePrice(s string) (input, output float64, err error) {
+	in, out, ok := strings.Cut(s, ",")
+	if ok {
+		input, err = strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err == nil {
+			output, err = strconv.ParseFloat(strings.TrimSpace(out), 64)
+		}
+	}
+	if !ok || err != nil || input < 0 || output < 0 {
+		return 0, 0, fmt.Errorf("invalid -price %q (expected input,output per million tokens, e.g. 3,15)", s)
+	}
+	return input, output, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Clipboard modes accepted by -clipboard.
+const (
+	clipboardAuto  = "auto"
+	clipboardOSC52 = "osc52"
+	clipboardNone  = "none"
+)
+
+// clipboardFlag backs -clipboard. Given without a value, or as true, it
+// picks the clipboard automatically; false is the same as none.
+type clipboardFlag struct {
+	mode string
+}
+
+func (f *clipboardFlag) String() string { return f.mode }
+
+func (f *clipboardFlag) Set(value string) error {
+	switch value {
+	case clipboardAuto, "true":
+		f.mode = clipboardAuto
+	case clipboardOSC52:
+		f.mode = clipboardOSC52
+	case clipboardNone, "false":
+		f.mode = clipboardNone
+	default:
+		return fmt.Errorf("expected %s, %s or %s", clipboardAuto, clipboardOSC52, clipboardNone)
+	}
+	return nil
+}
+
+func (f *clipboardFlag) IsBoolFlag() bool { return true }
+
+// nativeClipboard, where the platform has one, copies text with the
+// system's clipboard API rather than a command.
+var nativeClipboard func(text string) error
+
+// overSSH reports whether collect runs in an SSH session, where the local
+// clipboard is out of reach of any command or API, so OSC52 is used instead.
+func overSSH() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+}
+
+// clipboardCommand returns the command that copies its stdin to the system
+// clipboard, or nil if there is none.
+func clipboardCommand() *exec.Cmd {
+	has := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+	switch {
+	case has("pbcopy"):
+		return exec.Command("pbcopy")
+	case os.Getenv("WSL_DISTRO_NAME") != "" && has("clip.exe"):
+		return exec.Command("clip.exe")
+	case os.Getenv("WAYLAND_DISPLAY") != "" && has("wl-copy"):
+		return exec.Command("wl-copy")
+	case has("xclip"):
+		return exec.Command("xclip", "-selection", "clipboard")
+	case has("xsel"):
+		return exec.Command("xsel", "--clipboard", "--input")
+	}
+	return nil
+}
+
+// copyToClipboard copies text with the clipboard selected by mode. In auto
+// mode OSC52 is only used over SSH: a local terminal may ignore the sequence
+// without telling, which would lose the collection, so without a clipboard
+// API or command copying fails and the caller saves the text instead.
+func copyToClipboard(text, mode string) error {
+	if mode == clipboardAuto && !overSSH() {
+		if nativeClipboard != nil {
+			return nativeClipboard(text)
+		}
+		cmd := clipboardCommand()
+		if cmd == nil {
+			return fmt.Errorf("no clipboard command found; install one such as xclip or wl-copy, or use -clipboard=osc52 if the terminal supports it")
+		}
+		cmd.Stdin = strings.NewReader(text)
+		// The command's own messages are passed on as they are; a pipe would
+		// keep Wait waiting on xclip, which stays in the background to serve
+		// the selection.
+		cmd.Stderr = logOutput
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", cmd.Args[0], err)
+		}
+		return nil
+	}
+	if err := copyOSC52(text); err != nil {
+		return fmt.Errorf("the terminal is unreachable for OSC52: %w", err)
+	}
+	return nil
+}
+
+// saveUncopied writes text that could not be copied to a temporary file, so
+// that the collection is not lost, and returns the file's path.
+func saveUncopied(text string) (string, error) {
+	file, err := os.CreateTemp("", "collect-*.txt")
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", err
+	}
+	return file.Name(), file.Close()
+}
+
+// copyOSC52 asks the terminal to set the clipboard with the OSC52 escape
+// sequence, which works across SSH in most modern terminals. Inside tmux the
+// sequence has to be passed through to the outer terminal.
+func copyOSC52(text string) error {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONOUT$"
+	}
+	tty, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	sequence := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		sequence = "\x1bPtmux;" + strings.ReplaceAll(sequence, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	_, err = tty.WriteString(sequence)
+	return err
+}
+
+// pasteHeader introduces piece n of m of a collection copied with
+// -paste-chunks, asking the model to wait for the rest.
+func pasteHeader(n, m int) string {
+	if n == m {
+		return fmt.Sprintf("Part %d/%d, the final part.\n\n", n, m)
+	}
+	return fmt.Sprintf("Part %d/%d, reply OK until the final part.\n\n", n, m)
+}
+
+// pasteChunks cuts texts into pieces of at most size characters each,
+// header included, for chat inputs that limit how much can be pasted at
+// once. Pieces end at a line break where there is one, and are numbered
+// across all texts.
+func pasteChunks(texts []string, size int) ([]string, error) {
+	var bodies []string
+	for count := 1; ; {
+		room := size - utf8.RuneCountInString(pasteHeader(count-1, count))
+		if room < 1 {
+			return nil, fmt.Errorf("-paste-chunks %d leaves no room for the text", size)
+		}
+		bodies = bodies[:0]
+		for _, text := range texts {
+			for text != "" {
+				end := len(text)
+				if utf8.RuneCountInString(text) > room {
+					// The byte offset of the rune after the room.
+					end = 0
+					for i := 0; i < room; i++ {
+						_, n := utf8.DecodeRuneInString(text[end:])
+						end += n
+					}
+					if newline := strings.LastIndexByte(text[:end], '\n'); newline >= 0 {
+						end = newline + 1
+					}
+				}
+				bodies = append(bodies, text[:end])
+				text = text[end:]
+			}
+		}
+		// The headers are as long as the number of pieces has digits.
+		if len(strconv.Itoa(len(bodies))) <= len(strconv.Itoa(count)) {
+			break
+		}
+		count = len(bodies)
+	}
+	if len(bodies) <= 1 {
+		return bodies, nil
+	}
+	pieces := make([]string, len(bodies))
+	for i, body := range bodies {
+		pieces[i] = pasteHeader(i+1, len(bodies)) + body
+	}
+	return pieces, nil
+}
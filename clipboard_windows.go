@@ -0,0 +1,81 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	openClipboard    = user32.NewProc("OpenClipboard")
+	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
+	setClipboardData = user32.NewProc("SetClipboardData")
+	globalAlloc      = kernel32.NewProc("GlobalAlloc")
+	globalFree       = kernel32.NewProc("GlobalFree")
+	globalLock       = kernel32.NewProc("GlobalLock")
+	globalUnlock     = kernel32.NewProc("GlobalUnlock")
+	moveMemory       = kernel32.NewProc("RtlMoveMemory")
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+func init() {
+	nativeClipboard = copyWindows
+}
+
+// copyWindows puts text on the Windows clipboard as Unicode text. clip.exe
+// would read it in the console's code page, garbling anything outside it.
+func copyWindows(text string) error {
+	// The clipboard is opened for the calling thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	// Another program may be holding the clipboard for a moment.
+	var opened uintptr
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		if opened, _, err = openClipboard.Call(0); opened != 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if opened == 0 {
+		return fmt.Errorf("OpenClipboard: %w", err)
+	}
+	defer closeClipboard.Call()
+	if ok, _, err := emptyClipboard.Call(); ok == 0 {
+		return fmt.Errorf("EmptyClipboard: %w", err)
+	}
+
+	data := utf16.Encode([]rune(text + "\x00"))
+	size := uintptr(len(data) * 2)
+	handle, _, err := globalAlloc.Call(gmemMoveable, size)
+	if handle == 0 {
+		return fmt.Errorf("GlobalAlloc: %w", err)
+	}
+	memory, _, err := globalLock.Call(handle)
+	if memory == 0 {
+		globalFree.Call(handle)
+		return fmt.Errorf("GlobalLock: %w", err)
+	}
+	moveMemory.Call(memory, uintptr(unsafe.Pointer(&data[0])), size)
+	globalUnlock.Call(handle)
+	// Once set, the memory belongs to the clipboard.
+	if ok, _, err := setClipboardData.Call(cfUnicodeText, handle); ok == 0 {
+		globalFree.Call(handle)
+		return fmt.Errorf("SetClipboardData: %w", err)
+	}
+	return nil
+}
@@ -2,308 +2,2204 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
-	"github.com/pkoukk/tiktoken-go"
+	"collect/pkg/collect"
 )
 
-var totalTokens int
-
-const maxTotalTokens = 50000
-const maxFileSize = 1 * 1024 * 1024
+// logOutput receives errors and warnings, and infoOutput progress messages,
+// skip messages and the summary, which -quiet silences. Both are stderr, so
+// that stdout carries only output that scripts may want to capture.
+var (
+	logOutput  io.Writer = os.Stderr
+	infoOutput io.Writer = os.Stderr
+)
 
-var encoder, err = tiktoken.EncodingForModel("gpt-4o")
+// parseExtensions splits a comma-separated extension list, lowercasing each
+// entry and adding the leading dot if it was left out.
+func parseExtensions(list string) []string {
+	var extensions []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
 
-func init() {
+// readPatternFile reads one pattern per line, skipping blank lines and #
+// comments. A missing file yields no patterns.
+func readPatternFile(path string) ([]string, error) {
+	var patterns []string
+	file, err := os.Open(path)
 	if err != nil {
-		fmt.Println("Error initializing tokenizer:", err)
-		os.Exit(1)
+		if os.IsNotExist(err) {
+			return patterns, nil
+		}
+		return nil, err
 	}
-}
+	defer file.Close()
 
-func isIgnored(path string, ignorePatterns []string) bool {
-	for _, pattern := range ignorePatterns {
-		matched, err := filepath.Match(pattern, filepath.Base(path))
-		if err != nil {
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		if matched || strings.Contains(path, pattern) {
-			return true
-		}
+		patterns = append(patterns, line)
 	}
-	return false
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
 }
 
-func isIncluded(path string, includePatterns []string) bool {
-	if len(includePatterns) == 0 {
-		return true
+// diffChangedLines returns the line numbers of the working tree version of path
+// that were added or modified relative to ref, according to git diff hunks.
+func diffChangedLines(path, ref string) (map[int]bool, error) {
+	out, err := exec.Command("git", "diff", "-U0", "--no-color", ref, "--", path).Output()
+	if err != nil {
+		return nil, err
 	}
-	for _, pattern := range includePatterns {
-		matched, err := filepath.Match(pattern, filepath.Base(path))
+	changed := make(map[int]bool)
+	// The diff holds the changed lines themselves, which can be longer than
+	// a bufio.Scanner allows.
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+		// Hunk headers look like "@@ -12,3 +14,5 @@"; only the new side matters.
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+			continue
+		}
+		start, count := fields[2][1:], "1"
+		if i := strings.Index(start, ","); i >= 0 {
+			start, count = start[:i], start[i+1:]
+		}
+		first, err := strconv.Atoi(start)
 		if err != nil {
 			continue
 		}
-		if matched || strings.HasSuffix(path, pattern) {
-			return true
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			continue
+		}
+		for l := first; l < first+n; l++ {
+			changed[l] = true
 		}
 	}
-	return false
+	return changed, nil
 }
 
-func isBinaryFile(path string) (bool, error) {
-	file, err := os.Open(path)
+// pipeThrough runs content through an external shell command acting as a
+// filter and returns what it writes to stdout. The file's relative path is
+// exposed to the command as COLLECT_FILE. On Windows the shell is cmd.
+func pipeThrough(command, relativePath, content string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Env = append(os.Environ(), "COLLECT_FILE="+relativePath)
+	cmd.Stdin = strings.NewReader(content)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
 	if err != nil {
-		return false, err
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", err
 	}
-	defer file.Close()
+	return string(out), nil
+}
 
-	buf := make([]byte, 8000)
-	n, err := file.Read(buf)
-	if err != nil && err != io.EOF {
-		return false, err
+// unescape expands backslash escapes such as \n and \t in flag values, so
+// separators can be given on the command line without literal newlines.
+func unescape(value string) string {
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(value, `"`, `\"`) + `"`)
+	if err != nil {
+		return value
 	}
+	return unquoted
+}
 
-	for i := 0; i < n; i++ {
-		if buf[i] == 0 {
-			return true, nil
+// writeSummaryCSV writes one row per candidate file, largest token count first.
+func writeSummaryCSV(path string, stats []collect.FileStat) error {
+	sorted := make([]collect.FileStat, len(stats))
+	copy(sorted, stats)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Tokens != sorted[j].Tokens {
+			return sorted[i].Tokens > sorted[j].Tokens
 		}
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"path", "bytes", "lines", "tokens", "language", "status"})
+	for _, stat := range sorted {
+		w.Write([]string{
+			stat.Path,
+			strconv.FormatInt(stat.Bytes, 10),
+			strconv.Itoa(stat.Lines),
+			strconv.Itoa(stat.Tokens),
+			stat.Language,
+			stat.Status,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
 	}
-	return false, nil
+	return file.Close()
 }
 
-func countTokens(text string) int {
-	tokens := encoder.Encode(text, nil, nil)
-	return len(tokens)
+// generatedFlag backs -include-generated. Given without a value it includes
+// every generated file; given a comma-separated list it includes only those.
+type generatedFlag struct {
+	all     bool
+	include []string
 }
 
-func copyToClipboard(text string) {
-	var cmd *exec.Cmd
-	if _, err := exec.LookPath("pbcopy"); err == nil {
-		cmd = exec.Command("pbcopy")
-	} else if _, err := exec.LookPath("xclip"); err == nil {
-		cmd = exec.Command("xclip", "-selection", "clipboard")
-	} else {
-		fmt.Println("Clipboard copy not supported on this platform.")
-		return
+func (g *generatedFlag) String() string {
+	if g.all {
+		return "true"
 	}
-	in, _ := cmd.StdinPipe()
-	cmd.Start()
-	in.Write([]byte(text))
-	in.Close()
-	cmd.Wait()
+	return strings.Join(g.include, ",")
 }
 
-func parseGitignore(rootDir string) ([]string, error) {
-	var gitignorePatterns []string
-	gitignorePath := filepath.Join(rootDir, ".gitignore")
-	file, err := os.Open(gitignorePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return gitignorePatterns, nil
-		}
-		return nil, err
+func (g *generatedFlag) Set(value string) error {
+	switch value {
+	case "true":
+		g.all = true
+	case "false":
+		g.all = false
+		g.include = nil
+	default:
+		g.include = append(g.include, strings.Split(value, ",")...)
 	}
-	defer file.Close()
+	return nil
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+func (g *generatedFlag) IsBoolFlag() bool { return true }
+
+func (g *generatedFlag) keeps(pattern string) bool {
+	for _, p := range g.include {
+		if p == pattern {
+			return true
 		}
-		gitignorePatterns = append(gitignorePatterns, line)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	return false
+}
+
+// refFlag backs flags that take an optional git ref: given without a value
+// they compare against HEAD.
+type refFlag struct {
+	ref string
+}
+
+func (r *refFlag) String() string { return r.ref }
+
+func (r *refFlag) Set(value string) error {
+	switch value {
+	case "true":
+		r.ref = "HEAD"
+	case "false":
+		r.ref = ""
+	default:
+		r.ref = value
 	}
-	return gitignorePatterns, nil
+	return nil
 }
 
-func collectFilesContent(rootDir string, includePatterns, ignorePatterns []string) (string, string) {
-	var collectedContent strings.Builder
-	var files []string
+func (r *refFlag) IsBoolFlag() bool { return true }
 
-	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		relativePath, _ := filepath.Rel(rootDir, path)
+// sinceFlag backs -since, which takes how far back to look, as a duration
+// (90m, 2h) or a number of days (3d), or a date or time to look back to
+// (2024-06-01, 2024-06-01T09:00), in local time.
+type sinceFlag struct {
+	text     string
+	duration time.Duration
+	time     time.Time
+}
 
-		if d.IsDir() {
-			if isIgnored(relativePath, ignorePatterns) {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+// sinceLayouts are the date and time forms -since accepts.
+var sinceLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05", time.RFC3339}
 
-		if isIgnored(relativePath, ignorePatterns) {
+func (f *sinceFlag) String() string { return f.text }
+
+func (f *sinceFlag) Set(value string) error {
+	*f = sinceFlag{text: value}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			f.duration = time.Duration(n) * 24 * time.Hour
 			return nil
 		}
-
-		if !isIncluded(relativePath, includePatterns) {
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		f.duration = d
+		return nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			f.time = t
 			return nil
 		}
+	}
+	return fmt.Errorf("expected a duration such as 2h or 3d, or a date such as 2024-06-01")
+}
 
-		files = append(files, path)
-		return nil
-	})
+// cutoff is the time files must have been modified after.
+func (f *sinceFlag) cutoff() time.Time {
+	if f.duration > 0 {
+		return time.Now().Add(-f.duration)
+	}
+	return f.time
+}
+
+// budgetsFlag backs -budget, adding the pattern=tokens rules of each use.
+type budgetsFlag struct {
+	budgets *[]collect.Budget
+}
+
+func (f budgetsFlag) String() string {
+	if f.budgets == nil {
+		return ""
+	}
+	rules := make([]string, len(*f.budgets))
+	for i, budget := range *f.budgets {
+		rules[i] = fmt.Sprintf("%s=%d", budget.Pattern, budget.MaxTokens)
+	}
+	return strings.Join(rules, ",")
+}
 
+func (f budgetsFlag) Set(value string) error {
+	budgets, err := collect.ParseBudgets(value)
 	if err != nil {
-		fmt.Println("Error:", err)
+		return err
 	}
+	*f.budgets = append(*f.budgets, budgets...)
+	return nil
+}
 
-	var wg sync.WaitGroup
-	maxGoroutines := 10
-	sem := make(chan struct{}, maxGoroutines)
+// sizeFlag backs -max-file-size, accepting a byte count with an optional
+// B, KB, MB or GB suffix, e.g. 500KB or 1.5MB.
+type sizeFlag struct {
+	bytes *int64
+}
 
-	mu := &sync.Mutex{}
+func (f sizeFlag) String() string {
+	if f.bytes == nil {
+		return ""
+	}
+	return collect.FormatSize(int(*f.bytes))
+}
 
-	for _, path := range files {
-		mu.Lock()
-		if totalTokens >= maxTotalTokens {
-			mu.Unlock()
-			fmt.Println("Reached maximum token limit.")
+func (f sizeFlag) Set(value string) error {
+	number := strings.ToUpper(strings.TrimSpace(value))
+	unit := 1.0
+	for _, suffix := range []struct {
+		name string
+		size float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(number, suffix.name) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, suffix.name)), suffix.size
 			break
 		}
-		mu.Unlock()
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("expected a size such as 500KB or 2MB")
+	}
+	*f.bytes = int64(size * unit)
+	return nil
+}
 
-		wg.Add(1)
-		sem <- struct{}{}
-		go func(path string) {
-			defer wg.Done()
-			defer func() { <-sem }()
+// regexpsFlag backs flags taking a regular expression, which may be given
+// several times.
+type regexpsFlag struct {
+	regexps *[]*regexp.Regexp
+}
 
-			content, tokenCount, err := processFile(path, rootDir)
-			if err != nil {
-				fmt.Printf("Error processing file %s: %s\n", path, err)
-				return
-			}
+func (f regexpsFlag) String() string {
+	if f.regexps == nil {
+		return ""
+	}
+	var patterns []string
+	for _, re := range *f.regexps {
+		patterns = append(patterns, re.String())
+	}
+	return strings.Join(patterns, " ")
+}
 
-			mu.Lock()
-			if totalTokens+tokenCount <= maxTotalTokens {
-				collectedContent.WriteString(content)
-				totalTokens += tokenCount
-			} else {
-				fmt.Printf("Skipping file %s to stay within token limit.\n", path)
-			}
-			mu.Unlock()
-		}(path)
+func (f regexpsFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f.regexps = append(*f.regexps, re)
+	return nil
+}
+
+// stringsFlag backs flags that may be given several times, collecting
+// every value.
+type stringsFlag struct {
+	values *[]string
+}
+
+func (f stringsFlag) String() string {
+	if f.values == nil {
+		return ""
 	}
+	return strings.Join(*f.values, " ")
+}
 
-	wg.Wait()
+func (f stringsFlag) Set(value string) error {
+	*f.values = append(*f.values, value)
+	return nil
+}
 
-	fileTree := buildFileTree(files, rootDir)
+// splitLineRange separates a line range such as "100-250" from a path
+// argument written "src/server.go:100-250". Arguments naming an existing
+// file, colon and all, are left alone.
+func splitLineRange(arg string) (string, *collect.LineRange, error) {
+	i := strings.LastIndex(arg, ":")
+	if i < 0 {
+		return arg, nil, nil
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg, nil, nil
+	}
+	lines := arg[i+1:]
+	if lines == "" || strings.Trim(lines, "0123456789-") != "" {
+		return arg, nil, nil
+	}
+	r, err := collect.ParseLineRange(lines)
+	if err != nil {
+		return "", nil, err
+	}
+	return arg[:i], &r, nil
+}
 
-	return fileTree, collectedContent.String()
+// isValidRef reports whether ref names a commit in the repository at dir.
+func isValidRef(dir, ref string) bool {
+	return exec.Command("git", "-C", dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() == nil
 }
 
-func processFile(path, rootDir string) (string, int, error) {
-	info, err := os.Stat(path)
+// changedFiles lists the files under dir that differ from ref in the working
+// tree, plus untracked files that are not ignored, relative to dir and
+// sorted like a walk would be.
+func changedFiles(dir, ref string) ([]string, error) {
+	changed, err := gitFiles(dir, "diff", "-z", "--name-only", "--relative", "--no-renames", ref, "--")
 	if err != nil {
-		return "", 0, fmt.Errorf("Error stating file %s: %s", path, err)
+		return nil, err
 	}
-	relativePath, _ := filepath.Rel(rootDir, path)
-	if info.Size() > maxFileSize {
-		fmt.Printf("Skipping large file (>1MB): %s\n", relativePath)
-		return "", 0, nil
+	untracked, err := gitFiles(dir, "ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
 	}
+	files := append(changed, untracked...)
+	sort.Strings(files)
+	return files, nil
+}
 
-	isBinary, err := isBinaryFile(path)
+// touchedFiles lists the files under dir, relative to it and sorted, that
+// commits since cutoff changed, or that were changed or added since cutoff
+// without being committed yet. Files since deleted are left out.
+func touchedFiles(dir string, cutoff time.Time) ([]string, error) {
+	committed, err := gitFiles(dir, "log", "-z", "--name-only", "--format=", "--relative", "--no-renames", "--since="+cutoff.Format(time.RFC3339), "--")
+	if err != nil {
+		return nil, err
+	}
+	uncommitted, err := gitFiles(dir, "diff", "-z", "--name-only", "--relative", "--no-renames", "HEAD", "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitFiles(dir, "ls-files", "-z", "--others", "--exclude-standard")
 	if err != nil {
-		return "", 0, fmt.Errorf("Error checking if file is binary: %s", err)
+		return nil, err
 	}
-	if isBinary {
-		fmt.Printf("Skipping binary file: %s\n", relativePath)
-		return "", 0, nil
+	seen := make(map[string]bool)
+	files := []string{}
+	for i, list := range [][]string{committed, append(uncommitted, untracked...)} {
+		for _, file := range list {
+			if seen[file] {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file)))
+			// Uncommitted changes count from when they were made.
+			if err != nil || i == 1 && info.ModTime().Before(cutoff) {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
 	}
+	sort.Strings(files)
+	return files, nil
+}
 
-	file, err := os.Open(path)
+// trackedFiles lists the files git knows about under dir, tracked or
+// untracked but not ignored, relative to dir and sorted like a walk would be.
+func trackedFiles(dir string) ([]string, error) {
+	files, err := gitFiles(dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
 	if err != nil {
-		return "", 0, fmt.Errorf("Error opening file %s: %s", relativePath, err)
+		return nil, err
 	}
-	defer file.Close()
+	sort.Strings(files)
+	return files, nil
+}
 
-	var fileContent strings.Builder
-	fileContent.WriteString(fmt.Sprintf("File: %s\n", relativePath))
+// gitFiles runs a git command in dir that prints NUL-separated file names
+// (given -z, so unusual names are not quoted) and returns them.
+func gitFiles(dir string, args ...string) ([]string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
 
-	scanner := bufio.NewScanner(file)
+// readFileList reads the paths listed one per line in source, or on stdin
+// if source is "-", and returns them relative to baseDir. Relative paths in
+// the list are taken from the current directory, and paths outside baseDir
+// are left out.
+func readFileList(source, baseDir string) ([]string, error) {
+	in := os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+	}
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	scanner := bufio.NewScanner(in)
 	for scanner.Scan() {
-		fileContent.WriteString(scanner.Text() + "\n")
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		abs, err := filepath.Abs(line)
+		if err != nil {
+			return nil, err
+		}
+		if !isWithin(absBase, abs) {
+			fmt.Fprintf(infoOutput, "Skipping %s: outside %s\n", line, baseDir)
+			continue
+		}
+		rel, _ := filepath.Rel(absBase, abs)
+		files = append(files, filepath.ToSlash(rel))
 	}
-	if err := scanner.Err(); err != nil {
-		return "", 0, fmt.Errorf("Error reading file %s: %s", relativePath, err)
+	return files, scanner.Err()
+}
+
+// isGitWorkTree reports whether dir is inside a git work tree.
+func isGitWorkTree(dir string) bool {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// splitRepo splits a -repo argument into the URL to clone and the ref after
+// its last "@", if any. An "@" before the first "/" past the scheme belongs
+// to the user of the URL, as in git@github.com:org/name.
+func splitRepo(spec string) (string, string) {
+	i := strings.LastIndex(spec, "@")
+	if i < 0 {
+		return spec, ""
+	}
+	head := spec[:i]
+	if j := strings.Index(head, "://"); j >= 0 {
+		head = head[j+3:]
+	}
+	if !strings.Contains(head, "/") {
+		return spec, ""
+	}
+	return spec[:i], spec[i+1:]
+}
+
+// cloneRepo fetches the single commit of a -repo argument into a new
+// temporary directory and returns it; the caller removes it. Fetching rather
+// than cloning also works for commit hashes, not just branches and tags.
+func cloneRepo(spec string) (string, error) {
+	url, ref := splitRepo(spec)
+	if ref == "" {
+		ref = "HEAD"
 	}
-	fileContent.WriteString("\n")
+	dir, err := os.MkdirTemp("", "collect-repo-")
+	if err != nil {
+		return "", err
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", url, ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Stderr = logOutput
+		if err := cmd.Run(); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+	}
+	return dir, nil
+}
 
-	tokenCount := countTokens(fileContent.String())
+// Exit codes, so that scripts can tell a run that fell short from one that
+// failed.
+const (
+	exitError      = 1
+	exitOverBudget = 2 // files were dropped to stay within -max-tokens
+	exitNoFiles    = 3 // nothing matched
+)
 
-	return fileContent.String(), tokenCount, nil
+// interruptContext returns a context cancelled by Ctrl-C, on which a
+// collection finishes the files already being read and keeps what was
+// collected; a second Ctrl-C terminates immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
 }
 
-func buildFileTree(files []string, rootDir string) string {
-	var builder strings.Builder
-	for _, path := range files {
-		relativePath, _ := filepath.Rel(rootDir, path)
-		builder.WriteString(relativePath + "\n")
+// cleanups undo what a run leaves behind, such as the clone of -repo. exit
+// runs them, since os.Exit skips deferred calls, and so does main on return.
+var cleanups []func()
+
+func runCleanups() {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
 	}
-	return builder.String()
+	cleanups = nil
 }
 
-func main() {
-	includePtr := flag.String("include", "", "Comma-separated list of file extensions or patterns to include (e.g., .go,.txt).")
-	ignorePtr := flag.String("ignore", "", "Comma-separated list of patterns to ignore.")
-	parseGitignorePtr := flag.Bool("gitignore", true, "Parse .gitignore files to exclude patterns.")
-	flag.Parse()
+// exit ends collect with code after running the cleanups.
+func exit(code int) {
+	runCleanups()
+	os.Exit(code)
+}
 
-	includePatterns := strings.Split(*includePtr, ",")
-	if *includePtr == "" {
-		includePatterns = []string{}
+// exitCode is the status a run ends with: success, unless it collected no
+// files or its total exceeds the budget. maxTokens is the budget collect count
+// checks the total against, which is 0 when the budget was applied instead.
+func exitCode(result collect.Result, maxTokens int) int {
+	if result.TotalFiles == 0 {
+		return exitNoFiles
+	}
+	if maxTokens > 0 && result.TotalTokens > maxTokens {
+		return exitOverBudget
+	}
+	for _, stat := range result.Files {
+		if stat.Status == collect.StatusSkippedBudget {
+			return exitOverBudget
+		}
 	}
+	return 0
+}
 
-	userIgnorePatterns := strings.Split(*ignorePtr, ",")
-	if *ignorePtr == "" {
-		userIgnorePatterns = []string{}
+// runSummary is the JSON run report -summary-json writes.
+type runSummary struct {
+	ExitCode    int            `json:"exit_code"`
+	DurationMS  int64          `json:"duration_ms"`
+	TotalTokens int            `json:"total_tokens"`
+	MaxTokens   int            `json:"max_tokens"`
+	Bytes       int            `json:"bytes"`
+	Included    int            `json:"included"`
+	Skipped     int            `json:"skipped"`
+	Files       []reportRecord `json:"files"`
+}
+
+// writeSummaryJSON writes the run report: the totals and exit code, and like
+// writeReport every file the walk saw, in path order, with its decision.
+func writeSummaryJSON(path string, result collect.Result, maxTokens, code int, duration time.Duration) error {
+	summary := runSummary{
+		ExitCode:    code,
+		DurationMS:  duration.Milliseconds(),
+		TotalTokens: result.TotalTokens,
+		MaxTokens:   maxTokens,
+		Bytes:       result.TotalBytes,
+		Files:       []reportRecord{},
+	}
+	for _, record := range reportRecords(append(append([]collect.FileStat{}, result.Files...), result.Filtered...)) {
+		if record.Decision == "included" {
+			summary.Included++
+		} else {
+			summary.Skipped++
+		}
+		summary.Files = append(summary.Files, record)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
 
-	rootDir := "."
+type reportRecord struct {
+	Path     string `json:"path"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	Tokens   int    `json:"tokens"`
+}
+
+// writeReport writes a JSON Lines record for every file the walk saw, in path
+// order, stating whether it was included and if not, why.
+func writeReport(path string, stats []collect.FileStat) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	defaultIgnorePatterns := []string{
-		".git", ".svn", ".hg",
-		"node_modules", "venv", "env", "__pycache__", "target", "bin", "obj",
-		"build", "dist", "out",
-		".idea", ".vscode", ".settings",
-		"*.log", "*.tmp", "*.swp",
-		"*.exe", "*.dll", "*.so", "*.bin", "*.class", "*.jar", "*.war",
-		"*.jpg", "*.jpeg", "*.png", "*.gif", "*.mp3", "*.mp4",
-		"*.zip", "*.tar", "*.gz", "*.7z", "*.rar",
-		"_build", "site",
+	encoder := json.NewEncoder(file)
+	for _, record := range reportRecords(stats) {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
 	}
+	return file.Close()
+}
 
-	ignorePatterns := append(defaultIgnorePatterns, userIgnorePatterns...)
+// reportRecords states for every file, in path order, whether it was
+// included and if not, why.
+func reportRecords(stats []collect.FileStat) []reportRecord {
+	sorted := make([]collect.FileStat, len(stats))
+	copy(sorted, stats)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
 
-	if *parseGitignorePtr {
-		gitignorePatterns, err := parseGitignore(rootDir)
-		if err != nil {
-			fmt.Printf("Error parsing .gitignore: %s\n", err)
-		} else {
-			ignorePatterns = append(ignorePatterns, gitignorePatterns...)
+	records := make([]reportRecord, len(sorted))
+	for i, stat := range sorted {
+		records[i] = reportRecord{
+			Path:     stat.Path,
+			Decision: "skipped",
+			Reason:   stat.Reason,
+			Bytes:    stat.Bytes,
+			Tokens:   stat.Tokens,
 		}
+		if stat.Status == collect.StatusCollected {
+			records[i].Decision = "included"
+		}
+	}
+	return records
+}
+
+// countRecord is what collect count prints with -json.
+type countRecord struct {
+	TotalTokens int  `json:"total_tokens"`
+	MaxTokens   int  `json:"max_tokens"`
+	Files       int  `json:"files"`
+	Bytes       int  `json:"bytes"`
+	OverBudget  bool `json:"over_budget"`
+}
+
+// writeCount prints the totals of collect count, and reports whether they
+// exceed maxTokens; a maxTokens of 0 is no limit.
+func writeCount(w io.Writer, result collect.Result, maxTokens int, asJSON bool) (bool, error) {
+	record := countRecord{
+		TotalTokens: result.TotalTokens,
+		MaxTokens:   maxTokens,
+		Files:       result.TotalFiles,
+		Bytes:       result.TotalBytes,
+		OverBudget:  maxTokens > 0 && result.TotalTokens > maxTokens,
 	}
+	if asJSON {
+		return record.OverBudget, json.NewEncoder(w).Encode(record)
+	}
+	_, err := fmt.Fprintf(w, "%d tokens, %s across %d files\n", record.TotalTokens, collect.FormatSize(record.Bytes), record.Files)
+	return record.OverBudget, err
+}
 
-	fileTree, collectedContent := collectFilesContent(rootDir, includePatterns, ignorePatterns)
-	totalContent := fmt.Sprintf("File Tree:\n%s\n\nContents:\n%s", fileTree, collectedContent)
+// printList writes the candidate files in walk order with their tokens, size
+// and the running total, noting why skipped files were skipped, followed by
+// the paths the filters rejected.
+func printList(w io.Writer, result collect.Result) {
+	fmt.Fprintf(w, "%8s %8s %9s  %s\n", "TOKENS", "TOTAL", "SIZE", "PATH")
+	total := 0
+	for _, stat := range result.Files {
+		if stat.Status != collect.StatusCollected {
+			fmt.Fprintf(w, "%8s %8s %9s  %s (%s: %s)\n", "-", "-", collect.FormatSize(int(stat.Bytes)), stat.Path, stat.Status, stat.Reason)
+			continue
+		}
+		total += stat.Tokens
+		note := ""
+		if stat.Truncated {
+			note = " (truncated)"
+		}
+		fmt.Fprintf(w, "%8d %8d %9s  %s%s\n", stat.Tokens, total, collect.FormatSize(int(stat.Bytes)), stat.Path, note)
+	}
+	if len(result.Filtered) > 0 {
+		fmt.Fprintln(w, "\nFiltered out:")
+		for _, stat := range result.Filtered {
+			fmt.Fprintf(w, "  %s (%s)\n", stat.Path, stat.Reason)
+		}
+	}
+	fmt.Fprintf(w, "\nTotal: %d tokens, %s across %d files\n", result.TotalTokens, collect.FormatSize(result.TotalBytes), result.TotalFiles)
+}
 
-	copyToClipboard(totalContent)
-	fmt.Printf("Total tokens used: %d\n", totalTokens)
+// writeSavings reports the tokens -strip-comments, -strip-blank-lines,
+// -minify-data and -strip-license-headers saved, and with verbose how many each file lost.
+func writeSavings(w io.Writer, stats []collect.FileStat, verbose bool) {
+	saved, kept := 0, 0
+	for _, stat := range stats {
+		if stat.Status == collect.StatusCollected {
+			saved += stat.Saved
+			kept += stat.Tokens
+		}
+	}
+	if saved == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Stripping saved %d tokens (%d%%).\n", saved, saved*100/(saved+kept))
+	if !verbose {
+		return
+	}
+	for _, stat := range stats {
+		if stat.Status == collect.StatusCollected && stat.Saved > 0 {
+			fmt.Fprintf(w, "  %8d  %s\n", stat.Saved, stat.Path)
+		}
+	}
+}
 
+// writeFileDetails lists the tokens and size of every collected file, and
+// the reason each other candidate was skipped.
+func writeFileDetails(w io.Writer, stats []collect.FileStat) {
+	for _, stat := range stats {
+		if stat.Status == collect.StatusCollected {
+			fmt.Fprintf(w, "  %8d tokens %9s  %s\n", stat.Tokens, collect.FormatSize(int(stat.Bytes)), stat.Path)
+		} else {
+			fmt.Fprintf(w, "  %8s        %9s  %s (%s: %s)\n", "-", collect.FormatSize(int(stat.Bytes)), stat.Path, stat.Status, stat.Reason)
+		}
+	}
 }
 
+// primaryLanguages summarizes the languages holding the largest share of
+// collected tokens, e.g. "Go (72%), TypeScript (18%)". Files of unknown
+// language count towards the total but are not listed.
+func primaryLanguages(stats []collect.FileStat, limit int) string {
+	tokensByLanguage := map[string]int{}
+	total := 0
+	for _, stat := range stats {
+		if stat.Status != collect.StatusCollected {
+			continue
+		}
+		total += stat.Tokens
+		if stat.Language != "" {
+			tokensByLanguage[stat.Language] += stat.Tokens
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(tokensByLanguage))
+	for name := range tokensByLanguage {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if tokensByLanguage[names[i]] != tokensByLanguage[names[j]] {
+			return tokensByLanguage[names[i]] > tokensByLanguage[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	var parts []string
+	for _, name := range names {
+		share := tokensByLanguage[name] * 100 / total
+		if len(parts) == limit || share < 1 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d%%)", name, share))
+	}
+	return strings.Join(parts, ", ")
+}
 
+// writeStats breaks the collected tokens down by directory and by extension
+// and lists the largest files, showing limit rows per table.
+func writeStats(w io.Writer, stats []collect.FileStat, limit int) {
+	byDir := map[string]int{}
+	byExt := map[string]int{}
+	var files []collect.FileStat
+	total := 0
+	for _, stat := range stats {
+		if stat.Status != collect.StatusCollected {
+			continue
+		}
+		total += stat.Tokens
+		byDir[path.Dir(stat.Path)] += stat.Tokens
+		ext := strings.ToLower(path.Ext(stat.Path))
+		if ext == "" {
+			ext = "(none)"
+		}
+		byExt[ext] += stat.Tokens
+		files = append(files, stat)
+	}
+	if total == 0 {
+		return
+	}
+
+	table := func(title string, tokens map[string]int) {
+		names := make([]string, 0, len(tokens))
+		for name := range tokens {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if tokens[names[i]] != tokens[names[j]] {
+				return tokens[names[i]] > tokens[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for i, name := range names {
+			if i == limit {
+				fmt.Fprintf(w, "  ... %d more\n", len(names)-limit)
+				break
+			}
+			fmt.Fprintf(w, "  %8d %5.1f%%  %s\n", tokens[name], float64(tokens[name])*100/float64(total), name)
+		}
+	}
+	table("Tokens by directory", byDir)
+	table("Tokens by extension", byExt)
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Tokens > files[j].Tokens })
+	fmt.Fprintln(w, "\nLargest files:")
+	for i, stat := range files {
+		if i == limit {
+			break
+		}
+		fmt.Fprintf(w, "  %8d %5.1f%%  %s\n", stat.Tokens, float64(stat.Tokens)*100/float64(total), stat.Path)
+	}
+}
+
+// writeBudgets reports how much of each -budget the collection used.
+func writeBudgets(w io.Writer, budgets []collect.BudgetUsage) {
+	if len(budgets) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nBudgets:")
+	for _, budget := range budgets {
+		fmt.Fprintf(w, "  %8d / %-8d %5.1f%%  %s (%d files", budget.Tokens, budget.MaxTokens, float64(budget.Tokens)*100/float64(budget.MaxTokens), budget.Pattern, budget.Files)
+		if budget.Skipped > 0 {
+			fmt.Fprintf(w, ", %d skipped", budget.Skipped)
+		}
+		fmt.Fprintln(w, ")")
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal rather than a pipe
+// or a regular file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// isFlagSet reports whether the named flag was given on the command line or
+// by the config file, as opposed to holding its default.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// resolveRoots turns the path arguments into the roots to collect and the
+// base directory output paths are relative to. The arguments are relative to
+// dir, or to the current directory if dir is empty, and without arguments
+// that directory is collected. The base is that directory when every root
+// lies inside it, and otherwise the closest directory containing all roots.
+// Roots are returned as slash-separated paths relative to the base.
+func resolveRoots(dir string, args []string) (string, []string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, err
+	}
+	// The current directory is named ".", any other by its path.
+	top, topName := cwd, "."
+	if dir != "" {
+		top, topName = dir, dir
+	}
+
+	var absRoots []string
+	base := ""
+	for _, arg := range args {
+		if !filepath.IsAbs(arg) {
+			arg = filepath.Join(top, arg)
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		absRoot, err := filepath.Abs(arg)
+		if err != nil {
+			return "", nil, err
+		}
+		absRoots = append(absRoots, absRoot)
+
+		dir := absRoot
+		if !info.IsDir() {
+			dir = filepath.Dir(absRoot)
+		}
+		if base == "" {
+			base = dir
+		}
+		for !isWithin(base, dir) {
+			base = filepath.Dir(base)
+		}
+	}
+
+	allInside := true
+	for _, absRoot := range absRoots {
+		allInside = allInside && isWithin(top, absRoot)
+	}
+	name := base
+	if allInside {
+		base, name = top, topName
+	}
+
+	roots := make([]string, len(absRoots))
+	for i, absRoot := range absRoots {
+		relativeRoot, _ := filepath.Rel(base, absRoot)
+		roots[i] = filepath.ToSlash(relativeRoot)
+	}
+	return name, roots, nil
+}
+
+// isWithin reports whether path is dir or lies below it; both are absolute.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// promptText combines the content of the file at path, if any, with text.
+func promptText(path, text string) (string, error) {
+	if path == "" {
+		return text, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return string(data), nil
+	}
+	return strings.TrimRight(string(data), "\n") + "\n\n" + text, nil
+}
+
+// partPath numbers an output file for one part of a split collection, e.g.
+// context.txt becomes context.2.txt.
+func partPath(path string, part int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), part, ext)
+}
+
+// outputFilter returns the Collector's IsOutput for a collection of baseDir
+// that writes the document to output, or its split parts, such as
+// context.2.txt for context.txt, and the other files given, all as on the
+// command line, so that a run does not collect what it or an earlier run
+// wrote. It returns nil if no file is written.
+func outputFilter(baseDir, output string, others []string) func(string) bool {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil
+	}
+	written := make(map[string]bool)
+	for _, other := range append([]string{output}, others...) {
+		if other == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(other); err == nil {
+			written[abs] = true
+		}
+	}
+	if len(written) == 0 {
+		return nil
+	}
+	// isPart reports whether abs is partPath of the output for some part.
+	isPart := func(abs string) bool { return false }
+	if absOutput, err := filepath.Abs(output); output != "" && err == nil {
+		ext := filepath.Ext(absOutput)
+		stem := strings.TrimSuffix(absOutput, ext) + "."
+		isPart = func(abs string) bool {
+			number, ok := strings.CutPrefix(abs, stem)
+			if !ok {
+				return false
+			}
+			if number, ok = strings.CutSuffix(number, ext); !ok || number == "" {
+				return false
+			}
+			return strings.Trim(number, "0123456789") == ""
+		}
+	}
+	return func(p string) bool {
+		abs := filepath.Join(base, filepath.FromSlash(p))
+		return written[abs] || isPart(abs)
+	}
+}
+
+// commands are the subcommands of collect. They all share the same flags;
+// without one, collect copies.
+var commands = []struct{ name, summary string }{
+	{"copy", "Collect the files and copy them to the clipboard, or write them to -output or stdout (the default)."},
+	{"count", "Count the tokens of every file in scope and exit with status 2 if they exceed -max-tokens, for CI."},
+	{"list", "Print the files that would be collected and what would be skipped and why, like -list."},
+	{"watch", "Collect again whenever a file in scope changes, like -watch."},
+	{"ask", "Collect the files and send them with a question to -model, streaming the answer: collect ask \"question\" [options] [path ...]."},
+	{"snapshot", "Record the files in scope (collect snapshot save name), or later collect only those added or changed since (collect snapshot diff name)."},
+	{"init", "Write a starter " + configFileName + " to the current directory, from the languages of the files in scope and the .gitignore."},
+	{"completion", "Print the shell completion script: collect completion bash|zsh|fish."},
+	{"serve", "Answer requests for context from other programs: -mcp serves the Model Context Protocol over stdio, -http serves HTTP."},
+}
+
+// parseCommand splits the subcommand off the arguments, defaulting to copy.
+func parseCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		for _, command := range commands {
+			if args[0] == command.name {
+				return command.name, args[1:]
+			}
+		}
+	}
+	return "copy", args
+}
+
+// usage prints the subcommands before the flags they share.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage: collect [command] [options] [path ...]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintf(w, "\nOptions:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	defer runCleanups()
+	command, args := parseCommand(os.Args[1:])
+	// collect count checks the collection against the budget instead of
+	// applying it.
+	countCommand := command == "count"
+	var question string
+	if command == "ask" {
+		if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+			fmt.Fprintln(logOutput, "Error: collect ask needs a question, e.g. collect ask \"how is auth handled?\"")
+			exit(exitError)
+		}
+		question, args = args[0], args[1:]
+	}
+	var snapshotAction, snapshotName string
+	if command == "snapshot" {
+		if len(args) < 2 || (args[0] != "save" && args[0] != "diff") {
+			fmt.Fprintln(logOutput, "Error: collect snapshot needs save or diff and a name, e.g. collect snapshot save before-refactor")
+			exit(exitError)
+		}
+		snapshotAction, snapshotName, args = args[0], args[1], args[2:]
+	}
+
+	c := collect.New()
+	includePtr := flag.String("include", "", "Comma-separated list of file extensions or patterns to include (e.g., .go,.txt).")
+	ignorePtr := flag.String("ignore", "", "Comma-separated list of patterns to ignore.")
+	flag.Var(regexpsFlag{&c.IncludeRegexps}, "include-re", "Only collect files whose relative path matches this RE2 `regexp`; may be repeated.")
+	flag.Var(regexpsFlag{&c.IgnoreRegexps}, "ignore-re", "Leave out files and directories whose relative path matches this RE2 `regexp` (e.g., '_generated\\.(go|ts)$'); may be repeated.")
+	noDefaultIgnorePtr := flag.Bool("no-default-ignore", false, "Do not apply the built-in ignore patterns.")
+	defaultIgnoreFilePtr := pathFlag("default-ignore-file", "File with patterns (one per line) that replace the built-in ignore patterns.")
+	parseGitignorePtr := flag.Bool("gitignore", true, "Parse .gitignore files to exclude patterns.")
+	ignoreFilesPtr := flag.Bool("ignore-files", true, "Apply .collectignore and .ignore files, which use .gitignore syntax.")
+	parseGitattributesPtr := flag.Bool("gitattributes", true, "Skip files that .gitattributes marks linguist-vendored or linguist-generated.")
+	flag.BoolVar(&c.Hidden, "hidden", false, "Collect hidden files and directories, those whose name starts with a dot (the ignore patterns still apply).")
+	flag.IntVar(&c.MaxDepth, "max-depth", 0, "Only collect files at most this many levels below each path; 1 collects the files directly in it (0 for unlimited).")
+	flag.BoolVar(&c.FollowSymlinks, "follow-symlinks", false, "Collect the files and walk the directories symbolic links point to, instead of skipping the links; links leading in circles are still skipped.")
+	flag.BoolVar(&c.AllowOutsideRoot, "allow-outside-root", false, "Let -follow-symlinks follow links that lead outside the collected directory.")
+	archivePtr := pathFlag("archive", "Collect the files inside this zip or tar (.tar.gz, .tgz, .tar.bz2) archive without extracting it. Paths are taken inside the archive.")
+	repoPtr := flag.String("repo", "", "Collect from a shallow clone of this git `URL` instead of the current directory; append @ref for a branch, tag or commit (e.g., https://github.com/org/name@v1.2.0). Paths are taken inside the repository.")
+	filesFromPtr := pathFlag("files-from", "Collect the files listed one per line in this file, or on stdin with -, instead of walking the directory (e.g., git diff --name-only main | collect -files-from -).")
+	trackedPtr := flag.Bool("tracked", false, "Take the files from git ls-files (tracked and untracked but not ignored) instead of walking the directory; ignored outside git repositories.")
+	var gitDiff refFlag
+	flag.Var(&gitDiff, "git-diff", "Only collect files changed relative to a git ref, plus untracked files; use -git-diff=main to pick the ref (default HEAD).")
+	var withDiff refFlag
+	flag.Var(&withDiff, "with-diff", "Append the unified diff against a git ref after the file contents; use -with-diff=main to pick the ref (default HEAD).")
+	withLogPtr := flag.Int("with-log", 0, "Append the subjects and messages of the last `N` commits touching the collected directories as a \"Recent History\" section.")
+	withBlamePtr := flag.Bool("with-blame", false, "Append a \"File History\" section saying, for each collected file, when and in which commit it last changed and who wrote its lines, from git blame.")
+	var withDeps []string
+	flag.Var(stringsFlag{&withDeps}, "with-deps", "Also collect the Go files of this `package`, such as github.com/gin-gonic/gin@v1.9, from the module cache; the version defaults to the one go.mod requires. May be repeated.")
+	depsFromImportsPtr := flag.Bool("deps-from-imports", false, "Also collect, from the module cache, the Go packages of other modules that the Go files collected import.")
+	flag.BoolVar(&c.GoOrder, "go-order", false, "Order Go files so that each package comes before the packages importing it.")
+	flag.BoolVar(&c.ImportGraph, "import-graph", false, "Append an \"Import Graph\" section listing the packages of the Go module each package imports.")
+	flag.BoolVar(&c.LineNumbers, "line-numbers", false, "Prefix every line with its number.")
+	flag.Var(stringsFlag{&c.Symbols}, "symbol", "Only collect the Go declarations matching this `symbol`, by name (Handle, Server.Handle) or the start of its source (\"func (s *Server) Handle\"); may be repeated.")
+	annotateDiffPtr := flag.String("annotate-diff", "", "Git ref to diff against; lines changed since the ref are prefixed with '+'.")
+	flag.IntVar(&c.MaxTokens, "max-tokens", c.MaxTokens, "Maximum total tokens to collect (0 for unlimited).")
+	flag.Var(budgetsFlag{&c.Budgets}, "budget", "Comma-separated `pattern=tokens` budgets for subtrees, such as 'internal/**=20000,docs=5000', each limiting the tokens of the files it matches within -max-tokens.")
+	flag.Var(sizeFlag{&c.MaxFileSize}, "max-file-size", "Files larger than this `size` (e.g., 500KB or 5MB; 0 for no limit) are handled by -large-files.")
+	flag.StringVar(&c.LargeFiles, "large-files", collect.LargeFilesSkip, "What to do with files over -max-file-size: skip them, truncate them to that size (keeping the part chosen by -truncate) or include them in full.")
+	extractPtr := flag.String("extract", strings.Join(c.Extract, ","), "Comma-separated document formats to collect the text of instead of their content: pdf, docx and html (converted to Markdown), ipynb (reduced to the source of the cells), or none.")
+	flag.IntVar(&c.ExtractTokens, "extract-tokens", c.ExtractTokens, "Cut the text extracted from each document down to this many tokens (0 for no limit).")
+	flag.BoolVar(&c.KeepOutputs, "keep-outputs", false, "Keep the text outputs of notebook cells, which -extract=ipynb drops.")
+	flag.BoolVar(&c.Placeholders, "placeholders", c.Placeholders, "Collect binary files and files over -max-file-size as a one-line placeholder with their size and type instead of skipping them.")
+	flag.StringVar(&c.Truncate, "truncate", "", "Collect part of a file instead of skipping it when it does not fit the token budget: head, tail, head-tail or middle-out.")
+	flag.IntVar(&c.TruncateTokens, "truncate-tokens", 0, "Cut every file larger than this many tokens down to it, keeping the part chosen by -truncate (head by default).")
+	priorityPtr := flag.String("priority", "", "Comma-separated patterns ranking files for the token budget, most important first, with * for all other files; include ranks by the -include patterns, none keeps the collection order (default: READMEs, manifests and entry points first, tests last).")
+	tokenizerPtr := flag.String("tokenizer", "bpe", "How tokens are counted: bpe uses the model's encoding, approximate estimates them from byte and word counts.")
+	flag.IntVar(&c.Jobs, "jobs", 10, "Number of files read and tokenized at once.")
+	tokenCachePtr := flag.Bool("token-cache", true, "Remember the token counts of large files in the user cache directory, so unchanged files are not tokenized again.")
+	modelPtr := flag.String("model", "gpt-4o", "Model whose tokenizer counts tokens: a model (gpt-4o, gpt-4, ...), an encoding (o200k_base, cl100k_base, ...) or approximate.")
+	var since sinceFlag
+	flag.Var(&since, "since", "Only include files modified within this `window`: a duration (e.g., 90m, 24h, 3d) or a date or time to look back to (e.g., 2024-06-01, 2024-06-01T09:00).")
+	sinceByPtr := flag.String("since-by", "mtime", "How -since tells when a file was modified: mtime, or git for the files changed by commits in the window plus uncommitted changes made in it.")
+	flag.StringVar(&c.Format, "format", collect.FormatText, "Output format: text, markdown, xml, json or html.")
+	flag.StringVar(&c.Tree, "tree", c.Tree, "Layout of the file tree before the contents: tree (nested directories), flat (one path per line) or none.")
+	flag.BoolVar(&c.TreeTokens, "tree-tokens", false, "Show the token count of every file and directory in the file tree.")
+	fileHeaderPtr := flag.String("file-header", `File: %s\n`, "Format of the header written before each file; %s is replaced by the relative path.")
+	fileSeparatorPtr := flag.String("file-separator", `\n`, "Text written after each file's content.")
+	secretsPtr := flag.String("secrets", "off", "What to do with files containing credentials such as API keys or private keys: redact, skip, fail or off.")
+	flag.BoolVar(&c.RedactPII, "redact-pii", false, "Mask email addresses, phone numbers and IP addresses in the collected content.")
+	flag.BoolVar(&c.Outline, "outline", false, "Reduce source files (Go, Python, TypeScript, JavaScript, Java, Rust, ...) to their declarations and signatures, dropping function bodies.")
+	flag.BoolVar(&c.StripComments, "strip-comments", false, "Remove comments from source files in languages with a known comment syntax.")
+	flag.BoolVar(&c.StripBlankLines, "strip-blank-lines", false, "Remove empty and whitespace-only lines from every file.")
+	flag.BoolVar(&c.MinifyData, "minify-data", false, "Compact JSON, YAML and XML files by stripping indentation, comments and insignificant whitespace.")
+	flag.BoolVar(&c.AnonymizePaths, "anonymize-paths", false, "Name files and directories by placeholders such as dir_01/file_03.go in the output, writing the mapping to the real names to -path-map.")
+	pathMapPtr := pathFlag("path-map", "File the -anonymize-paths mapping is read from and written to (default: one per directory in the user cache directory).")
+	flag.BoolVar(&c.Dedup, "dedup", false, "Collect files with identical content once, collecting the later copies as a line naming the first.")
+	flag.BoolVar(&c.StripLicenseHeaders, "strip-license-headers", false, "Remove the copyright and license comment at the top of every file, noting once which licenses were removed.")
+	flag.IntVar(&c.SampleArrays, "sample-arrays", 0, "With -minify-data, keep only this many elements of longer JSON arrays and YAML sequences (0 keeps all).")
+	pipeThroughPtr := flag.String("pipe-through", "", "Shell command each file's content is piped through before counting (e.g., a redaction filter).")
+	flag.IntVar(&c.ExpandTabs, "expand-tabs", 0, "Convert leading tabs to this many spaces (0 keeps tabs).")
+	flag.BoolVar(&c.TrimTrailing, "trim-trailing", false, "Strip trailing whitespace from every line.")
+	flag.StringVar(&c.Encoding, "encoding", collect.EncodingAuto, "Text encoding of the files: auto detects UTF-16 and Latin-1 and transcodes them to UTF-8; utf-8, utf-16le, utf-16be or latin1 forces one.")
+	flag.BoolVar(&c.NormalizeEOL, "normalize-eol", false, "Convert CRLF and CR line endings to LF and end every file with a newline, instead of keeping content byte for byte.")
+	flag.BoolVar(&c.Fast, "fast", false, "Only read files with known text extensions and skip binary detection, for quick estimates.")
+	textExtPtr := flag.String("text-ext", "", "Comma-separated extensions always treated as text, skipping binary detection (e.g., .ipynb,.svg).")
+	binaryExtPtr := flag.String("binary-ext", "", "Comma-separated extensions always skipped as binary.")
+	var includeGenerated generatedFlag
+	flag.Var(&includeGenerated, "include-generated", "Collect lockfiles and generated files, including those marked as generated in their first lines; use -include-generated=go.sum,yarn.lock to opt in only specific lockfiles and patterns.")
+	summaryFilePtr := pathFlag("summary-file", "Write per-file token statistics as CSV to this path.")
+	summaryJSONPtr := pathFlag("summary-json", "Write a JSON run report with the totals, duration, exit code and every file's include/skip decision to this path.")
+	reportPtr := pathFlag("report", "Write a JSON Lines record per file with the include/skip decision and reason to this path.")
+	manifestPtr := pathFlag("manifest", "Write a JSON manifest of the collected files and their token counts to this path.")
+	comparePtr := pathFlag("compare", "Compare the collection with a previously written JSON manifest and print the differences.")
+	compareMaxIncreasePtr := flag.Int("compare-max-increase", 0, "With -compare, exit with status 1 if total tokens grew by more than this (0 disables the check).")
+	flag.IntVar(&c.Chunks, "split", 0, "Split the collection into this many parts, each with its own file tree.")
+	flag.IntVar(&c.ChunkTokens, "chunk-tokens", 0, "Split the collection into parts of at most this many tokens.")
+	pasteChunksPtr := flag.Int("paste-chunks", 0, "Copy the collection to the clipboard in pieces of at most this many characters, each headed Part N/M, waiting for Enter between pieces, for chat inputs that limit how much can be pasted.")
+	watchPtr := flag.Bool("watch", false, "Keep running and collect again whenever a file in scope changes.")
+	yesPtr := flag.Bool("yes", false, "Skip the files that do not fit -max-tokens without asking which files to drop or truncate instead.")
+	interactivePtr := flag.Bool("interactive", false, "Pick the files to collect from a tree with live token counts before copying.")
+	statsPtr := flag.Bool("stats", false, "After collecting, print the tokens by directory and by extension and the largest files.")
+	statsTopPtr := flag.Int("stats-top", 10, "Number of rows in each -stats table.")
+	listPtr := flag.Bool("list", false, "Print the files that would be collected with their token counts and sizes, and what would be skipped and why, without copying anything.")
+	countOnlyPtr := flag.Bool("count-only", false, "Print only the total token count to stdout, without copying anything.")
+	mcpPtr := flag.Bool("mcp", false, "With collect serve, speak the Model Context Protocol over stdin and stdout, for agents such as Claude Desktop or Cursor.")
+	httpPtr := flag.String("http", "", "With collect serve, serve GET /context and GET /tree on this `address` (e.g., :8080, which listens on localhost only).")
+	apiURLPtr := flag.String("api-url", "", "With collect ask, the `URL` to send the question to instead of the OpenAI or Anthropic API, e.g. a local OpenAI-compatible server.")
+	pricePtr := flag.String("price", "", "With collect ask, the US dollars per million input and output tokens (e.g., 3,15), to report what the question cost.")
+	jsonPtr := flag.Bool("json", false, "With collect count, print the totals as a JSON object.")
+	prependPtr := flag.String("prepend", "", "Prompt text placed before the collected files (e.g., instructions); counts against the token budget.")
+	prependFilePtr := pathFlag("prepend-file", "File whose content is placed before the collected files, ahead of -prepend.")
+	appendPtr := flag.String("append", "", "Prompt text placed after the collected files (e.g., a question); counts against the token budget.")
+	appendFilePtr := pathFlag("append-file", "File whose content is placed after the collected files, ahead of -append.")
+	templatePtr := pathFlag("template", "Go text/template file laying out the prompt, with {{.FileTree}}, {{.Contents}}, {{.Document}}, {{.TotalTokens}}, {{.TotalFiles}} and {{.Root}}.")
+	wrapStartPtr := flag.String("wrap-start", "", "Text placed before the entire collected output (e.g., <<<BEGIN>>>).")
+	wrapEndPtr := flag.String("wrap-end", "", "Text placed after the entire collected output (e.g., <<<END>>>).")
+	var outputPath string
+	pathFlagVar(&outputPath, "output", "Write the collected content to this file instead of copying it to the clipboard.")
+	flag.StringVar(&outputPath, "o", "", "Shorthand for -output.")
+	clipboard := clipboardFlag{mode: clipboardAuto}
+	flag.Var(&clipboard, "clipboard", "Copy the collected content to the clipboard: auto, osc52 (the terminal's clipboard, e.g. over SSH) or none (off by default when -output is set).")
+	verbosePtr := flag.Bool("verbose", false, "Print per-file details: the tokens and size of each collected file and the tokens it lost to stripping.")
+	quietPtr := flag.Bool("quiet", false, "Print only errors and warnings, leaving out skip messages and the summary.")
+	profilePtr := flag.String("profile", "", "Name of a [profiles.<name>] section in "+configFileName+" to apply.")
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
+	switch command {
+	case "list":
+		*listPtr = true
+	case "watch":
+		*watchPtr = true
+	}
+
+	switch command {
+	case "completion":
+		if flag.NArg() != 1 {
+			fmt.Fprintln(logOutput, "Error: collect completion needs a shell: bash, zsh or fish")
+			exit(exitError)
+		}
+		if err := writeCompletion(os.Stdout, flag.Arg(0)); err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		return
+	case "init":
+		if _, err := os.Stat(configFileName); err == nil {
+			fmt.Fprintf(logOutput, "Error: %s already exists\n", configFileName)
+			exit(exitError)
+		}
+	}
+
+	cfg, cfgPath, err := loadConfig(".")
+	if err != nil {
+		fmt.Fprintf(logOutput, "Error reading config: %s\n", err)
+		exit(exitError)
+	}
+	if *profilePtr != "" && cfgPath == "" {
+		fmt.Fprintf(logOutput, "Error: -profile requires a %s file\n", configFileName)
+		exit(exitError)
+	}
+	if err := applyConfig(cfg, *profilePtr); err != nil {
+		fmt.Fprintf(logOutput, "Error in %s: %s\n", cfgPath, err)
+		exit(exitError)
+	}
+
+	if c.MaxDepth < 0 {
+		fmt.Fprintln(logOutput, "Error: -max-depth cannot be negative")
+		exit(exitError)
+	}
+	if *withLogPtr < 0 {
+		fmt.Fprintln(logOutput, "Error: -with-log cannot be negative")
+		exit(exitError)
+	}
+	if c.SampleArrays < 0 {
+		fmt.Fprintln(logOutput, "Error: -sample-arrays cannot be negative")
+		exit(exitError)
+	}
+	if c.Jobs < 1 {
+		fmt.Fprintln(logOutput, "Error: -jobs must be at least 1")
+		exit(exitError)
+	}
+	if *jsonPtr && !countCommand {
+		fmt.Fprintln(logOutput, "Error: -json only applies to collect count")
+		exit(exitError)
+	}
+	if countCommand || snapshotAction == "save" {
+		*countOnlyPtr = true
+	}
+	if command == "snapshot" && *watchPtr {
+		fmt.Fprintln(logOutput, "Error: collect snapshot cannot be combined with -watch")
+		exit(exitError)
+	}
+	if command == "serve" && *mcpPtr == (*httpPtr != "") {
+		fmt.Fprintln(logOutput, "Error: collect serve needs either -mcp or -http")
+		exit(exitError)
+	}
+	if (*mcpPtr || *httpPtr != "") && command != "serve" {
+		fmt.Fprintln(logOutput, "Error: -mcp and -http only apply to collect serve")
+		exit(exitError)
+	}
+
+	// When piped (collect | llm), the collection itself goes to stdout.
+	toStdout := outputPath == "" && !*countOnlyPtr && !*listPtr && !isTerminal(os.Stdout)
+	if *pasteChunksPtr < 0 {
+		fmt.Fprintln(logOutput, "Error: -paste-chunks cannot be negative")
+		exit(exitError)
+	}
+	if *pasteChunksPtr > 0 && (clipboard.mode == clipboardNone || (outputPath != "" || toStdout) && !isFlagSet("clipboard")) {
+		fmt.Fprintln(logOutput, "Error: -paste-chunks copies to the clipboard, which is off with -output, -clipboard=none or a pipe unless -clipboard is given")
+		exit(exitError)
+	}
+	if *quietPtr {
+		if *verbosePtr {
+			fmt.Fprintln(logOutput, "Error: -quiet and -verbose cannot be combined")
+			exit(exitError)
+		}
+		infoOutput = io.Discard
+	}
+	c.Log = infoOutput
+	c.CountOnly = *countOnlyPtr || *listPtr
+	if *listPtr {
+		// The listing already says why each file was skipped.
+		c.Log = io.Discard
+	}
+
+	switch *tokenizerPtr {
+	case "bpe":
+		c.Tokenizer, err = collect.NewTokenizer(*modelPtr)
+	case "approximate":
+		c.Tokenizer = collect.ApproximateTokenizer{}
+	default:
+		err = fmt.Errorf("unknown -tokenizer %q (expected bpe or approximate)", *tokenizerPtr)
+	}
+	if err != nil {
+		fmt.Fprintln(logOutput, "Error initializing tokenizer:", err)
+		exit(exitError)
+	}
+	_, approximate := c.Tokenizer.(collect.ApproximateTokenizer)
+	if approximate && *tokenizerPtr == "bpe" && *modelPtr != "approximate" {
+		fmt.Fprintf(logOutput, "No published tokenizer for %s; token counts are approximate.\n", *modelPtr)
+	}
+	// Estimates are cheaper to make afresh than to look up.
+	var tokenCache *collect.TokenCache
+	if *tokenCachePtr && !approximate {
+		if dir, err := os.UserCacheDir(); err == nil {
+			name := "tokens-" + strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(*modelPtr) + ".json"
+			tokenCache, err = collect.OpenTokenCache(c.Tokenizer, filepath.Join(dir, "collect", name))
+			if err != nil {
+				fmt.Fprintf(logOutput, "Not caching token counts: %s\n", err)
+			} else {
+				c.Tokenizer = tokenCache
+			}
+		}
+	}
+
+	c.TextExtensions = parseExtensions(*textExtPtr)
+	c.BinaryExtensions = parseExtensions(*binaryExtPtr)
+	c.FileHeader = unescape(*fileHeaderPtr)
+	c.FileSeparator = unescape(*fileSeparatorPtr)
+	c.WrapStart = unescape(*wrapStartPtr)
+	c.WrapEnd = unescape(*wrapEndPtr)
+	c.Prepend, err = promptText(*prependFilePtr, unescape(*prependPtr))
+	if err == nil {
+		c.Append, err = promptText(*appendFilePtr, unescape(*appendPtr))
+	}
+	if err == nil && *templatePtr != "" {
+		c.Template, err = template.ParseFiles(*templatePtr)
+	}
+	if err != nil {
+		fmt.Fprintf(logOutput, "Error reading prompt: %s\n", err)
+		exit(exitError)
+	}
+	var askTo askConfig
+	var priceIn, priceOut float64
+	if command == "ask" {
+		// The question follows the files, so it counts against the budget.
+		if c.Append != "" {
+			question = strings.TrimRight(c.Append, "\n") + "\n\n" + question
+		}
+		c.Append = question
+		c.Chunks, c.ChunkTokens = 0, 0
+		askTo, err = newAskConfig(*modelPtr, *apiURLPtr)
+		if err == nil && *pricePtr != "" {
+			priceIn, priceOut, err = parsePrice(*pricePtr)
+		}
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+	}
+	// collect count measures everything, and only compares the total to
+	// the budget afterwards.
+	countBudget := c.MaxTokens
+	// runBudget is the budget the finished run is checked against.
+	runBudget := 0
+	if countCommand {
+		c.MaxTokens, c.Chunks, c.ChunkTokens = 0, 0, 0
+		runBudget = countBudget
+	}
+	// A snapshot records every file in scope, not just those in budget.
+	if snapshotAction == "save" {
+		c.MaxTokens, c.Chunks, c.ChunkTokens = 0, 0, 0
+	}
+	// Splitting exists so that nothing has to be dropped, so the overall
+	// budget only applies when asked for explicitly.
+	if (c.Chunks > 0 || c.ChunkTokens > 0) && !isFlagSet("max-tokens") {
+		c.MaxTokens = 0
+	}
+
+	paths, repoDir := flag.Args(), ""
+	// pathRanges holds the line ranges given with the path arguments.
+	pathRanges := make([]*collect.LineRange, len(paths))
+	for i, arg := range paths {
+		if paths[i], pathRanges[i], err = splitLineRange(arg); err != nil {
+			fmt.Fprintf(logOutput, "Error: %s in %s\n", err, arg)
+			exit(exitError)
+		}
+	}
+	if *repoPtr != "" {
+		if *watchPtr {
+			fmt.Fprintln(logOutput, "Error: -watch cannot be combined with -repo")
+			exit(exitError)
+		}
+		fmt.Fprintf(infoOutput, "Cloning %s...\n", *repoPtr)
+		dir, err := cloneRepo(*repoPtr)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error cloning %s: %s\n", *repoPtr, err)
+			exit(exitError)
+		}
+		cleanups = append(cleanups, func() { os.RemoveAll(dir) })
+		repoDir = dir
+	}
+	var baseDir string
+	var roots []string
+	var fsys fs.FS
+	if *archivePtr != "" {
+		if *repoPtr != "" || *watchPtr || *filesFromPtr != "" || *trackedPtr || gitDiff.ref != "" || withDiff.ref != "" || *annotateDiffPtr != "" || *withLogPtr != 0 || *withBlamePtr || len(withDeps) > 0 || *depsFromImportsPtr {
+			fmt.Fprintln(logOutput, "Error: -archive cannot be combined with -repo, -watch, -files-from or the git options")
+			exit(exitError)
+		}
+		fsys, err = collect.OpenArchive(*archivePtr)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading archive: %s\n", err)
+			exit(exitError)
+		}
+		baseDir, roots = *archivePtr, []string{"."}
+		if len(paths) > 0 {
+			roots = nil
+			for _, p := range paths {
+				p = path.Clean(filepath.ToSlash(p))
+				if _, err := fs.Stat(fsys, p); err != nil {
+					fmt.Fprintf(logOutput, "Error: %s is not in %s\n", p, *archivePtr)
+					exit(exitError)
+				}
+				roots = append(roots, p)
+			}
+		}
+	} else {
+		baseDir, roots, err = resolveRoots(repoDir, paths)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		fsys = collect.DirFS(baseDir)
+	}
+	c.Root = baseDir
+	if *repoPtr != "" {
+		c.Root = *repoPtr
+	}
+	c.Roots = roots
+	for i, r := range pathRanges {
+		if r != nil {
+			if c.Ranges == nil {
+				c.Ranges = make(map[string]collect.LineRange)
+			}
+			c.Ranges[roots[i]] = *r
+		}
+	}
+
+	for _, ref := range []string{gitDiff.ref, withDiff.ref, *annotateDiffPtr} {
+		if ref != "" && !isValidRef(baseDir, ref) {
+			fmt.Fprintf(logOutput, "Error: %s is not a valid git ref\n", ref)
+			exit(exitError)
+		}
+	}
+	if *filesFromPtr != "" && (gitDiff.ref != "" || *trackedPtr) {
+		fmt.Fprintln(logOutput, "Error: -files-from cannot be combined with -git-diff or -tracked")
+		exit(exitError)
+	}
+	if source := *filesFromPtr; source != "" {
+		c.Files, err = readFileList(source, baseDir)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading file list: %s\n", err)
+			exit(exitError)
+		}
+	}
+	sinceGit := false
+	switch *sinceByPtr {
+	case "mtime":
+		c.ModifiedSince, c.ModifiedAfter = since.duration, since.time
+	case "git":
+		if since.text == "" {
+			fmt.Fprintln(logOutput, "Error: -since-by=git needs -since")
+			exit(exitError)
+		}
+		if *filesFromPtr != "" || gitDiff.ref != "" || *trackedPtr || *archivePtr != "" {
+			fmt.Fprintln(logOutput, "Error: -since-by=git cannot be combined with -files-from, -git-diff, -tracked or -archive")
+			exit(exitError)
+		}
+		if !isGitWorkTree(baseDir) {
+			fmt.Fprintf(logOutput, "Error: -since-by=git needs a git repository, and %s is not in one\n", baseDir)
+			exit(exitError)
+		}
+		sinceGit = true
+	default:
+		fmt.Fprintf(logOutput, "Error: unknown -since-by %q (expected mtime or git)\n", *sinceByPtr)
+		exit(exitError)
+	}
+	useTracked := *trackedPtr && gitDiff.ref == ""
+	if useTracked && !isGitWorkTree(baseDir) {
+		fmt.Fprintf(infoOutput, "Not in a git repository, walking %s instead of using -tracked.\n", baseDir)
+		useTracked = false
+	}
+	if useTracked {
+		// git has already applied every exclude file.
+		*parseGitignorePtr = false
+	}
+	// readGit takes the file list and the diff section from git; -watch
+	// reads them again before every collection.
+	readGit := func() error {
+		if ref := gitDiff.ref; ref != "" {
+			files, err := changedFiles(baseDir, ref)
+			if err != nil {
+				return fmt.Errorf("listing files changed since %s: %w", ref, err)
+			}
+			c.Files = files
+		} else if sinceGit {
+			files, err := touchedFiles(baseDir, since.cutoff())
+			if err != nil {
+				return fmt.Errorf("listing files changed since %s: %w", since.text, err)
+			}
+			c.Files = files
+		} else if useTracked {
+			files, err := trackedFiles(baseDir)
+			if err != nil {
+				return fmt.Errorf("listing tracked files: %w", err)
+			}
+			c.Files = files
+		}
+		if ref := withDiff.ref; ref != "" {
+			args := append([]string{"-C", baseDir, "diff", "--no-color", "--relative", ref, "--"}, roots...)
+			diff, err := exec.Command("git", args...).Output()
+			if err != nil {
+				return fmt.Errorf("diffing against %s: %w", ref, err)
+			}
+			c.Sections = []collect.Section{{Name: "Diff", Language: "diff", Content: string(diff)}}
+		}
+		if *withLogPtr > 0 {
+			history, err := recentHistory(baseDir, *withLogPtr, roots)
+			if err != nil {
+				return fmt.Errorf("reading the history: %w", err)
+			}
+			c.Sections = append(c.Sections, collect.Section{Name: "Recent History", Content: history})
+		}
+		if *withBlamePtr {
+			c.FileSections = func(files []collect.FileStat) ([]collect.Section, error) {
+				summary := blameSummary(baseDir, files)
+				if summary == "" {
+					return nil, nil
+				}
+				return []collect.Section{{Name: "File History", Content: summary}}, nil
+			}
+		}
+		return nil
+	}
+	if err := readGit(); err != nil {
+		fmt.Fprintf(logOutput, "Error %s\n", err)
+		exit(exitError)
+	}
+	if len(withDeps) > 0 || *depsFromImportsPtr {
+		cache, err := moduleCache()
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error finding the module cache: %s\n", err)
+			exit(exitError)
+		}
+		required := requiredModules(baseDir)
+		specs := withDeps
+		if *depsFromImportsPtr {
+			specs = append(specs, importedPackages(fsys, roots, required)...)
+		}
+		var depFiles []string
+		if fsys, depFiles, err = addDependencies(fsys, specs, cache, required); err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		c.Roots = append(c.Roots, depFiles...)
+		if len(c.Files) > 0 {
+			c.Files = append(c.Files, depFiles...)
+		}
+	}
+	var pathMapFile string
+	if c.AnonymizePaths {
+		if withDiff.ref != "" || *withLogPtr != 0 || *withBlamePtr || snapshotAction == "diff" {
+			fmt.Fprintln(logOutput, "Error: -anonymize-paths cannot be combined with -with-diff, -with-log, -with-blame or snapshot diff, which name the real paths")
+			exit(exitError)
+		}
+		pathMapFile = *pathMapPtr
+		if pathMapFile == "" {
+			root := c.Root
+			if *repoPtr == "" && *archivePtr == "" {
+				root, _ = filepath.Abs(baseDir)
+			}
+			if pathMapFile, err = pathMapPath(root); err != nil {
+				fmt.Fprintf(logOutput, "Error: %s\n", err)
+				exit(exitError)
+			}
+		}
+		if c.PathAliases, err = readPathMap(pathMapFile); err != nil {
+			fmt.Fprintf(logOutput, "Error reading path map: %s\n", err)
+			exit(exitError)
+		}
+	}
+	if *archivePtr == "" {
+		c.IsOutput = outputFilter(baseDir, outputPath, []string{*reportPtr, *summaryFilePtr, *summaryJSONPtr, *manifestPtr, pathMapFile})
+	}
+	var snapshotFile string
+	if command == "snapshot" {
+		root := c.Root
+		if *repoPtr == "" && *archivePtr == "" {
+			root, _ = filepath.Abs(baseDir)
+		}
+		snapshotFile, err = snapshotPath(root, snapshotName)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+	}
+	var removed []string
+	if snapshotAction == "diff" {
+		c.Baseline, removed, err = loadSnapshot(snapshotFile, snapshotName, fsys)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading snapshot: %s\n", err)
+			exit(exitError)
+		}
+		if len(removed) > 0 {
+			c.Sections = append(c.Sections, collect.Section{Name: "Removed Since Snapshot", Content: strings.Join(removed, "\n")})
+		}
+	}
+	if gitDiff.ref != "" && len(c.Files) == 0 {
+		fmt.Fprintf(infoOutput, "No files changed since %s.\n", gitDiff.ref)
+	}
+	if ref := *annotateDiffPtr; ref != "" {
+		c.ChangedLines = func(path string) (map[int]bool, error) {
+			return diffChangedLines(filepath.Join(baseDir, filepath.FromSlash(path)), ref)
+		}
+	}
+	if *secretsPtr != "off" {
+		c.Secrets = *secretsPtr
+	}
+	if command := *pipeThroughPtr; command != "" {
+		c.Filter = func(path, content string) (string, error) {
+			return pipeThrough(command, path, content)
+		}
+	}
+
+	c.Include = strings.Split(*includePtr, ",")
+	if *includePtr == "" {
+		c.Include = []string{}
+	}
+
+	if c.TruncateTokens > 0 && c.Truncate == "" {
+		c.Truncate = collect.TruncateHead
+	}
+
+	c.Extract = nil
+	if *extractPtr != "none" && *extractPtr != "" {
+		c.Extract = strings.Split(*extractPtr, ",")
+	}
+
+	switch *priorityPtr {
+	case "":
+	case "none":
+		c.Priority = nil
+	case "include":
+		c.Priority = c.Include
+	default:
+		c.Priority = strings.Split(*priorityPtr, ",")
+	}
+
+	userIgnorePatterns := strings.Split(*ignorePtr, ",")
+	if *ignorePtr == "" {
+		userIgnorePatterns = []string{}
+	}
+
+	defaultIgnorePatterns := collect.DefaultIgnorePatterns
+	if *defaultIgnoreFilePtr != "" {
+		if _, err := os.Stat(*defaultIgnoreFilePtr); err != nil {
+			fmt.Fprintf(logOutput, "Error reading default ignore file: %s\n", err)
+			exit(exitError)
+		}
+		defaultIgnorePatterns, err = readPatternFile(*defaultIgnoreFilePtr)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading default ignore file: %s\n", err)
+			exit(exitError)
+		}
+	}
+	if *noDefaultIgnorePtr {
+		defaultIgnorePatterns = nil
+	}
+
+	c.Ignore = append(append([]string{}, defaultIgnorePatterns...), userIgnorePatterns...)
+
+	c.SkipGenerated = !includeGenerated.all
+	if !includeGenerated.all {
+		for _, pattern := range collect.DefaultGeneratedPatterns {
+			if !includeGenerated.keeps(pattern) {
+				c.Ignore = append(c.Ignore, pattern)
+			}
+		}
+	}
+
+	c.Gitignore = nil
+	if *parseGitignorePtr && *archivePtr != "" {
+		// Only the .gitignore files inside the archive apply.
+		c.Gitignore = &collect.Gitignore{}
+	} else if *parseGitignorePtr {
+		c.Gitignore, err = collect.LoadGitignores(baseDir)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error parsing .gitignore: %s\n", err)
+		}
+	}
+	if !*ignoreFilesPtr {
+		c.IgnoreFiles = nil
+	}
+	c.Gitattributes = nil
+	if *parseGitattributesPtr && *archivePtr != "" {
+		c.Gitattributes = &collect.Gitattributes{}
+	} else if *parseGitattributesPtr {
+		c.Gitattributes, err = collect.LoadGitattributes(baseDir)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error parsing .gitattributes: %s\n", err)
+		}
+	}
+
+	if command == "init" {
+		scan := *c
+		scan.MaxTokens, scan.Chunks, scan.ChunkTokens = 0, 0, 0
+		scan.CountOnly = true
+		scan.Log = io.Discard
+		candidates, err := scan.Collect(context.Background(), fsys)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		gitignore, err := readPatternFile(".gitignore")
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error reading .gitignore: %s\n", err)
+			exit(exitError)
+		}
+		content, include := starterConfig(candidates.Files, gitignore)
+		if err := writeStarterConfig(configFileName, content); err != nil {
+			fmt.Fprintf(logOutput, "Error writing %s: %s\n", configFileName, err)
+			exit(exitError)
+		}
+		fmt.Fprintf(infoOutput, "Wrote %s including %s.\n", configFileName, strings.Join(include, ", "))
+		return
+	}
+
+	if command == "serve" {
+		if *mcpPtr {
+			err = serveMCP(os.Stdin, os.Stdout, c, fsys, tokenCache)
+		} else {
+			err = serveHTTP(*httpPtr, c, fsys, tokenCache)
+		}
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error serving: %s\n", err)
+			exit(exitError)
+		}
+		return
+	}
+
+	if *interactivePtr {
+		// Count every candidate without a budget first, so the picker can
+		// show what each file would cost.
+		scan := *c
+		scan.MaxTokens, scan.Chunks, scan.ChunkTokens = 0, 0, 0
+		scan.Sections = nil
+		scan.Log = io.Discard
+		candidates, err := scan.Collect(context.Background(), fsys)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		var collected []collect.FileStat
+		for _, stat := range candidates.Files {
+			if stat.Status == collect.StatusCollected {
+				collected = append(collected, stat)
+			}
+		}
+		if len(collected) == 0 {
+			fmt.Fprintln(logOutput, "No files to pick from.")
+			return
+		}
+		selected, ok, err := pickFiles(collected, c.MaxTokens)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		if !ok {
+			fmt.Fprintln(logOutput, "Cancelled.")
+			return
+		}
+		c.Files = selected
+	}
+
+	// Before a collection that does not fit the budget is copied, ask which
+	// files to give up rather than skipping whatever comes last. Ctrl-C
+	// while counting skips the question and keeps the files counted so far,
+	// as it would during the collection.
+	if !*yesPtr && !*interactivePtr && !*watchPtr && !*countOnlyPtr && !*listPtr && c.MaxTokens > 0 && c.Chunks == 0 && c.ChunkTokens == 0 &&
+		isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		scan := *c
+		scan.MaxTokens = 0
+		scan.CountOnly = true
+		scan.Writer = nil
+		scan.FileSections = nil
+		scan.Log = io.Discard
+		ctx, stop := interruptContext()
+		candidates, err := scan.Collect(ctx, fsys)
+		interrupted := ctx.Err() != nil
+		// Stopping restores Ctrl-C, which the question then leaves to end
+		// collect.
+		stop()
+		switch {
+		case interrupted:
+			c.Files = []string{}
+			pending := 0
+			for _, stat := range candidates.Files {
+				switch stat.Status {
+				case collect.StatusCollected:
+					c.Files = append(c.Files, stat.Path)
+				case collect.StatusSkippedInterrupted:
+					pending++
+				}
+			}
+			fmt.Fprintf(logOutput, "Interrupted: collection is partial, %d files were still pending.\n", pending)
+		case err != nil:
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		case candidates.TotalTokens > c.MaxTokens:
+			dropped, limits, ok, err := resolveOverBudget(candidates.Files, candidates.TotalTokens, c.MaxTokens, os.Stdin, os.Stderr)
+			if err != nil {
+				fmt.Fprintf(logOutput, "Error: %s\n", err)
+				exit(exitError)
+			}
+			if !ok {
+				fmt.Fprintln(logOutput, "Cancelled.")
+				return
+			}
+			if len(dropped) > 0 {
+				c.Files = nil
+				for _, stat := range candidates.Files {
+					if stat.Status == collect.StatusCollected && !dropped[stat.Path] {
+						c.Files = append(c.Files, stat.Path)
+					}
+				}
+			}
+			if len(limits) > 0 {
+				c.FileTokens = limits
+			}
+		}
+	}
+
+	if command == "ask" {
+		result, err := c.Collect(context.Background(), fsys)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		fmt.Fprintf(infoOutput, "Asking %s about %d files (%d tokens)...\n", askTo.model, result.TotalFiles, result.TotalTokens)
+		usage, err := ask(askTo, result.Output, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(logOutput, "Error asking %s: %s\n", askTo.model, err)
+			exit(exitError)
+		}
+		fmt.Fprintf(infoOutput, "Used %d input and %d output tokens", usage.InputTokens, usage.OutputTokens)
+		if *pricePtr != "" {
+			fmt.Fprintf(infoOutput, ", about $%.4f", (float64(usage.InputTokens)*priceIn+float64(usage.OutputTokens)*priceOut)/1e6)
+		}
+		fmt.Fprintln(infoOutput, ".")
+		return
+	}
+
+	// run collects once and delivers the result.
+	// Unless the document is split or copied as well, it is written out as it
+	// is assembled instead of being built in memory first.
+	copyAlso := clipboard.mode != clipboardNone && isFlagSet("clipboard")
+	streaming := !c.CountOnly && c.Chunks == 0 && c.ChunkTokens == 0 && (outputPath != "" || toStdout) && !copyAlso
+	run := func() collect.Result {
+		start := time.Now()
+		ctx, stop := interruptContext()
+
+		var stream *bufio.Writer
+		if streaming {
+			out := os.Stdout
+			if outputPath != "" {
+				file, err := os.Create(outputPath)
+				if err != nil {
+					fmt.Fprintf(logOutput, "Error writing output file: %s\n", err)
+					exit(exitError)
+				}
+				defer file.Close()
+				out = file
+			}
+			stream = bufio.NewWriter(out)
+			c.Writer = stream
+		}
+
+		result, err := c.Collect(ctx, fsys)
+		if stream != nil {
+			if flushErr := stream.Flush(); err == nil {
+				err = flushErr
+			}
+		}
+		if ctx.Err() != nil {
+			pending := 0
+			for _, stat := range result.Files {
+				if stat.Status == collect.StatusSkippedInterrupted {
+					pending++
+				}
+			}
+			fmt.Fprintf(logOutput, "Interrupted: collection is partial, %d files were still pending.\n", pending)
+		} else if err != nil {
+			fmt.Fprintf(logOutput, "Error: %s\n", err)
+			exit(exitError)
+		}
+		stop()
+
+		if *summaryFilePtr != "" {
+			if err := writeSummaryCSV(*summaryFilePtr, result.Files); err != nil {
+				fmt.Fprintf(logOutput, "Error writing summary file: %s\n", err)
+			}
+		}
+
+		if tokenCache != nil {
+			if err := tokenCache.Save(); err != nil {
+				fmt.Fprintf(logOutput, "Error saving token counts: %s\n", err)
+			}
+		}
+
+		if pathMapFile != "" {
+			if err := writePathMap(pathMapFile, c.PathAliases); err != nil {
+				fmt.Fprintf(logOutput, "Error writing path map: %s\n", err)
+			} else {
+				fmt.Fprintf(infoOutput, "Wrote the real names of the anonymized paths to %s\n", pathMapFile)
+			}
+		}
+
+		if *summaryJSONPtr != "" {
+			if err := writeSummaryJSON(*summaryJSONPtr, result, countBudget, exitCode(result, runBudget), time.Since(start)); err != nil {
+				fmt.Fprintf(logOutput, "Error writing summary: %s\n", err)
+			}
+		}
+
+		if *reportPtr != "" {
+			if err := writeReport(*reportPtr, append(append([]collect.FileStat{}, result.Files...), result.Filtered...)); err != nil {
+				fmt.Fprintf(logOutput, "Error writing report: %s\n", err)
+			}
+		}
+
+		if *manifestPtr != "" || *comparePtr != "" {
+			current := result.Manifest()
+			if *manifestPtr != "" {
+				if err := writeManifest(*manifestPtr, current); err != nil {
+					fmt.Fprintf(logOutput, "Error writing manifest: %s\n", err)
+				}
+			}
+			if *comparePtr != "" {
+				baseline, err := readManifest(*comparePtr)
+				if err != nil {
+					fmt.Fprintf(logOutput, "Error reading baseline manifest: %s\n", err)
+					exit(exitError)
+				}
+				net := collect.CompareManifests(logOutput, baseline, current)
+				if *compareMaxIncreasePtr > 0 && net > *compareMaxIncreasePtr {
+					fmt.Fprintf(logOutput, "Token increase of %d exceeds the allowed %d.\n", net, *compareMaxIncreasePtr)
+					exit(exitError)
+				}
+			}
+		}
+
+		switch snapshotAction {
+		case "save":
+			if err := saveSnapshot(snapshotFile, result); err != nil {
+				fmt.Fprintf(logOutput, "Error saving snapshot: %s\n", err)
+				exit(exitError)
+			}
+			fmt.Fprintf(infoOutput, "Saved snapshot %s of %d files (%d tokens).\n", snapshotName, result.TotalFiles, result.TotalTokens)
+			return result
+		case "diff":
+			added, changed := 0, 0
+			for _, stat := range result.Files {
+				if stat.Status != collect.StatusCollected {
+					continue
+				}
+				if _, ok := c.Baseline[stat.Path]; ok {
+					changed++
+				} else {
+					added++
+				}
+			}
+			fmt.Fprintf(infoOutput, "Since snapshot %s: %d added, %d changed, %d removed.\n", snapshotName, added, changed, len(removed))
+		}
+
+		if *countOnlyPtr || *listPtr {
+			if countCommand {
+				over, err := writeCount(os.Stdout, result, countBudget, *jsonPtr)
+				if err != nil {
+					fmt.Fprintf(logOutput, "Error writing count: %s\n", err)
+					exit(exitError)
+				}
+				if over {
+					fmt.Fprintf(logOutput, "Total of %d tokens exceeds -max-tokens %d by %d.\n", result.TotalTokens, countBudget, result.TotalTokens-countBudget)
+				}
+			} else if *countOnlyPtr {
+				fmt.Println(result.TotalTokens)
+			} else {
+				printList(os.Stdout, result)
+			}
+			writeSavings(infoOutput, result.Files, *verbosePtr)
+			if *statsPtr {
+				writeStats(logOutput, result.Files, *statsTopPtr)
+				writeBudgets(logOutput, result.Budgets)
+			}
+			return result
+		}
+
+		parts := result.Parts
+		if len(parts) == 0 {
+			parts = []collect.Part{{Output: result.Output, Files: result.TotalFiles, Tokens: result.TotalTokens}}
+		}
+
+		if outputPath != "" {
+			for i, part := range parts {
+				path := outputPath
+				if len(parts) > 1 {
+					path = partPath(outputPath, i+1)
+				}
+				if streaming {
+					fmt.Fprintf(infoOutput, "Wrote %s\n", path)
+					continue
+				}
+				if err := os.WriteFile(path, []byte(part.Output), 0644); err != nil {
+					fmt.Fprintf(logOutput, "Error writing output file: %s\n", err)
+					exit(exitError)
+				}
+				fmt.Fprintf(infoOutput, "Wrote %s\n", path)
+			}
+		}
+		if toStdout && !streaming {
+			for _, part := range parts {
+				fmt.Print(part.Output)
+			}
+		}
+		if clipboard.mode != clipboardNone && ((outputPath == "" && !toStdout) || isFlagSet("clipboard")) {
+			// The pieces of -paste-chunks are copied in place of the parts, as
+			// parts of their own.
+			copied := parts
+			if *pasteChunksPtr > 0 {
+				texts := make([]string, len(parts))
+				for i, part := range parts {
+					texts[i] = part.Output
+				}
+				pieces, err := pasteChunks(texts, *pasteChunksPtr)
+				if err != nil {
+					fmt.Fprintf(logOutput, "Error: %s\n", err)
+					exit(exitError)
+				}
+				copied = make([]collect.Part, len(pieces))
+				for i, piece := range pieces {
+					copied[i] = collect.Part{Output: piece}
+				}
+			}
+			stdin := bufio.NewReader(os.Stdin)
+			for i, part := range copied {
+				if err := copyToClipboard(part.Output, clipboard.mode); err != nil {
+					fmt.Fprintf(logOutput, "Error copying to the clipboard: %s\n", err)
+					if outputPath != "" || toStdout {
+						break
+					}
+					// Rather than lose the collection, keep what is left of
+					// it in files.
+					for j := i; j < len(copied); j++ {
+						path, err := saveUncopied(copied[j].Output)
+						if err != nil {
+							fmt.Fprintf(logOutput, "Error saving the collection: %s\n", err)
+							exit(exitError)
+						}
+						fmt.Fprintf(logOutput, "Wrote %s instead.\n", path)
+					}
+					break
+				}
+				if len(copied) == 1 {
+					break
+				}
+				if *pasteChunksPtr > 0 {
+					fmt.Fprintf(logOutput, "Copied part %d of %d (%d characters).", i+1, len(copied), utf8.RuneCountInString(part.Output))
+				} else {
+					fmt.Fprintf(logOutput, "Copied part %d of %d (%d tokens, %d files).", i+1, len(copied), part.Tokens, part.Files)
+				}
+				if i < len(copied)-1 {
+					fmt.Fprint(logOutput, " Press Enter to copy the next part...")
+					if _, err := stdin.ReadString('\n'); err != nil {
+						fmt.Fprintln(logOutput)
+						break
+					}
+				} else {
+					fmt.Fprintln(logOutput)
+				}
+			}
+		}
+		fmt.Fprintf(infoOutput, "Total: %d tokens, %s across %d files\n", result.TotalTokens, collect.FormatSize(result.TotalBytes), result.TotalFiles)
+		if len(parts) > 1 {
+			fmt.Fprintf(infoOutput, "Split into %d parts:", len(parts))
+			for _, part := range parts {
+				fmt.Fprintf(infoOutput, " %d", part.Tokens)
+			}
+			fmt.Fprintln(infoOutput, " tokens")
+		}
+		if summary := primaryLanguages(result.Files, 3); summary != "" {
+			fmt.Fprintf(infoOutput, "Primary: %s\n", summary)
+		}
+		writeSavings(infoOutput, result.Files, *verbosePtr)
+		if *verbosePtr {
+			writeFileDetails(infoOutput, result.Files)
+		}
+		if *statsPtr {
+			writeStats(logOutput, result.Files, *statsTopPtr)
+			writeBudgets(logOutput, result.Budgets)
+		}
+		return result
+	}
+
+	result := run()
+	if !*watchPtr {
+		if code := exitCode(result, runBudget); code != 0 {
+			exit(code)
+		}
+		return
+	}
+	picked := c.Files
+	fmt.Fprintln(infoOutput, "Watching for changes, press Ctrl-C to stop.")
+	err = watchChanges(baseDir, roots, outputPath, result, func() collect.Result {
+		if err := readGit(); err != nil {
+			fmt.Fprintf(logOutput, "Error %s\n", err)
+		}
+		if *interactivePtr {
+			c.Files = picked
+		}
+		return run()
+	})
+	if err != nil {
+		fmt.Fprintf(logOutput, "Error watching for changes: %s\n", err)
+		exit(exitError)
+	}
+}
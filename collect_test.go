@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"collect/pkg/collect"
+)
+
+func TestOutputIsNotCollected(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.txt")
+	report := filepath.Join(dir, "report.jsonl")
+
+	// Collect twice into the same -output, as repeated runs do.
+	var outputs []string
+	for run := 0; run < 2; run++ {
+		c := collect.New()
+		c.Tokenizer = collect.ApproximateTokenizer{}
+		c.IsOutput = outputFilter(dir, output, []string{report})
+		result, err := c.Collect(context.Background(), collect.DirFS(dir))
+		if err != nil {
+			t.Fatalf("run %d: Collect: %v", run+1, err)
+		}
+		for _, stat := range result.Files {
+			if stat.Path != "a.txt" {
+				t.Errorf("run %d collected %s", run+1, stat.Path)
+			}
+		}
+		if err := os.WriteFile(output, []byte(result.Output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(report, []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, result.Output)
+	}
+	if outputs[1] != outputs[0] {
+		t.Errorf("second run's output differs from the first:\n%s\nwant:\n%s", outputs[1], outputs[0])
+	}
+	if strings.Contains(outputs[1], "out.txt") {
+		t.Errorf("output names its own file:\n%s", outputs[1])
+	}
+}
+
+func TestOutputFilterMatchesSplitParts(t *testing.T) {
+	dir := t.TempDir()
+	isOutput := outputFilter(dir, filepath.Join(dir, "docs", "context.txt"), []string{filepath.Join(dir, "report.jsonl")})
+	for p, want := range map[string]bool{
+		"docs/context.txt":     true,
+		"docs/context.1.txt":   true,
+		"docs/context.12.txt":  true,
+		"report.jsonl":         true,
+		"docs/context.txt.bak": false,
+		"docs/context.a.txt":   false,
+		"docs/context..txt":    false,
+		"context.2.txt":        false,
+		"docs/notes.txt":       false,
+	} {
+		if got := isOutput(p); got != want {
+			t.Errorf("isOutput(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
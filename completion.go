@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// completionFlag is a flag as shell completion offers it.
+type completionFlag struct {
+	name, summary string
+	// takesValue is false for boolean flags.
+	takesValue bool
+	// isPath is set for flags whose value is a file to complete.
+	isPath bool
+}
+
+// completionFlags lists the defined flags with the first sentence of their
+// usage, in the order flag.PrintDefaults shows them.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		_, usage := flag.UnquoteUsage(f)
+		summary, _, _ := strings.Cut(usage, ". ")
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:       f.Name,
+			summary:    strings.TrimSuffix(summary, "."),
+			takesValue: !ok || !boolFlag.IsBoolFlag(),
+			isPath:     configPathSettings[canonicalFlag(f.Name)],
+		})
+	})
+	return flags
+}
+
+// writeCompletion writes the completion script for shell, one of bash, zsh
+// and fish, offering the commands, the flags and, for paths, files.
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		names := make([]string, len(flags))
+		for i, f := range flags {
+			names[i] = "-" + f.name
+		}
+		var commandNames []string
+		for _, command := range commands {
+			commandNames = append(commandNames, command.name)
+		}
+		fmt.Fprintf(w, `# bash completion for collect; load it with: source <(collect completion bash)
+_collect() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    COMPREPLY=()
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+    fi
+}
+complete -o default -F _collect collect
+`, strings.Join(names, " "), strings.Join(commandNames, " "))
+	case "zsh":
+		// Brackets and colons end the parts of an _arguments spec.
+		escape := strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`, "'", `'\''`)
+		fmt.Fprintln(w, "#compdef collect")
+		fmt.Fprintln(w, "# zsh completion for collect; load it with: source <(collect completion zsh)")
+		fmt.Fprintln(w, "_collect() {")
+		fmt.Fprintln(w, "    local -a commands")
+		fmt.Fprintln(w, "    commands=(")
+		for _, command := range commands {
+			fmt.Fprintf(w, "        '%s:%s'\n", command.name, escape.Replace(command.summary))
+		}
+		fmt.Fprintln(w, "    )")
+		fmt.Fprintln(w, "    _arguments -s \\")
+		for _, f := range flags {
+			spec := "-" + f.name
+			switch {
+			case f.isPath:
+				spec += "=[" + escape.Replace(f.summary) + "]:file:_files"
+			case f.takesValue:
+				spec += "=[" + escape.Replace(f.summary) + "]:value: "
+			default:
+				spec += "[" + escape.Replace(f.summary) + "]"
+			}
+			fmt.Fprintf(w, "        '%s' \\\n", spec)
+		}
+		fmt.Fprintln(w, "        '1: :{_describe command commands; _files}' \\")
+		fmt.Fprintln(w, "        '*:file:_files'")
+		fmt.Fprintln(w, "}")
+		fmt.Fprintln(w, "compdef _collect collect")
+	case "fish":
+		escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+		fmt.Fprintln(w, "# fish completion for collect; load it with: collect completion fish | source")
+		for _, command := range commands {
+			fmt.Fprintf(w, "complete -c collect -n __fish_use_subcommand -a %s -d '%s'\n", command.name, escape.Replace(command.summary))
+		}
+		for _, f := range flags {
+			options := ""
+			switch {
+			case f.isPath:
+				options = " -r -F"
+			case f.takesValue:
+				options = " -x"
+			}
+			fmt.Fprintf(w, "complete -c collect -o %s%s -d '%s'\n", f.name, options, escape.Replace(f.summary))
+		}
+	default:
+		return fmt.Errorf("unknown shell %q (expected bash, zsh or fish)", shell)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const configFileName = ".collect.toml"
+
+// configPathSettings are the settings holding file paths, which are relative
+// to the config file rather than to wherever collect is run from. pathFlag
+// adds the flags it defines.
+var configPathSettings = map[string]bool{}
+
+// pathFlag defines a string flag holding a file path, which the config file
+// gives relative to itself.
+func pathFlag(name, usage string) *string {
+	p := new(string)
+	pathFlagVar(p, name, usage)
+	return p
+}
+
+// pathFlagVar is pathFlag storing the path in p.
+func pathFlagVar(p *string, name, usage string) {
+	configPathSettings[name] = true
+	flag.StringVar(p, name, "", usage)
+}
+
+// flagAliases maps short flag names to the flag they stand for.
+var flagAliases = map[string]string{"o": "output"}
+
+// canonicalFlag returns the name a flag is known by in the config.
+func canonicalFlag(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// config holds the settings read from a config file. Keys are flag names and
+// values are in the form the flag would accept on the command line: one for
+// a single value, or the items of an array.
+type config struct {
+	dir      string
+	settings map[string][]string
+	profiles map[string]map[string][]string
+}
+
+// findConfig looks for the config file in dir and then in each parent,
+// stopping at the root of the git repository dir is in, so that a whole
+// team shares the file checked in at the top of the project.
+func findConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, configFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads the config file found from dir. A missing file yields an
+// empty config rather than an error.
+func loadConfig(dir string) (*config, string, error) {
+	cfg := &config{settings: map[string][]string{}, profiles: map[string]map[string][]string{}}
+	path, err := findConfig(dir)
+	if err != nil || path == "" {
+		return cfg, "", err
+	}
+	cfg.dir = filepath.Dir(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	section := cfg.settings
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			profile, ok := strings.CutPrefix(name, "profiles.")
+			if !ok || profile == "" {
+				return nil, "", fmt.Errorf("%s:%d: unknown section [%s], expected [profiles.<name>]", path, lineNumber, name)
+			}
+			if _, exists := cfg.profiles[profile]; !exists {
+				cfg.profiles[profile] = map[string][]string{}
+			}
+			section = cfg.profiles[profile]
+			continue
+		}
+
+		key, rawValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, "", fmt.Errorf("%s:%d: expected key = value", path, lineNumber)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		value, err := parseConfigValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, "", fmt.Errorf("%s:%d: %s", path, lineNumber, err)
+		}
+		section[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	return cfg, path, nil
+}
+
+// stripComment removes a trailing # comment that is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue converts the TOML subset used by config files (strings,
+// numbers, booleans and arrays of them) into flag values: the items of an
+// array, or the single value.
+func parseConfigValue(raw string) ([]string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		value, err := parseConfigScalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	}
+	if !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("arrays must be written on a single line")
+	}
+	items := []string{}
+	for _, item := range splitArray(raw[1 : len(raw)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, err := parseConfigScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+// parseConfigScalar converts a string, number or boolean into a flag value.
+func parseConfigScalar(raw string) (string, error) {
+	if strings.HasPrefix(raw, `"`) {
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return value, nil
+	}
+	if strings.HasPrefix(raw, "'") {
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	}
+	if raw == "true" || raw == "false" {
+		return raw, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+	return "", fmt.Errorf("unsupported value %s", raw)
+}
+
+// splitArray splits the inside of an array literal on commas outside strings.
+func splitArray(inner string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+// repeatableFlag reports whether each use of the flag adds a value, as with
+// -include-re, rather than replacing the value.
+func repeatableFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case regexpsFlag, stringsFlag, budgetsFlag:
+		return true
+	}
+	return false
+}
+
+// applyConfig sets every flag named in the config, with the selected
+// profile's settings replacing the top-level ones, except for flags that were
+// given explicitly on the command line. Flags are set in name order, and a
+// repeatable flag once per item of an array; for the others, arrays become
+// comma-separated lists, matching how list flags are given on the command
+// line.
+func applyConfig(cfg *config, profile string) error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[canonicalFlag(f.Name)] = true
+	})
+
+	layers := []map[string][]string{cfg.settings}
+	if profile != "" {
+		settings, ok := cfg.profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(cfg.profiles))
+			for name := range cfg.profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) == 0 {
+				return fmt.Errorf("unknown profile %q, the file defines none", profile)
+			}
+			return fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(names, ", "))
+		}
+		layers = append(layers, settings)
+	}
+
+	settings := map[string][]string{}
+	for _, layer := range layers {
+		for name, values := range layer {
+			if name == "profile" || flag.Lookup(name) == nil {
+				return fmt.Errorf("unknown setting %q", name)
+			}
+			settings[name] = values
+		}
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if explicit[canonicalFlag(name)] {
+			continue
+		}
+		values := append([]string{}, settings[name]...)
+		if configPathSettings[canonicalFlag(name)] {
+			for i, value := range values {
+				// "-" stands for stdin, as in files-from = "-".
+				if value != "" && value != "-" && !filepath.IsAbs(value) {
+					values[i] = filepath.Join(cfg.dir, value)
+				}
+			}
+		}
+		if !repeatableFlag(flag.Lookup(name)) {
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, value := range values {
+			if err := flag.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value for %s: %s", name, err)
+			}
+		}
+	}
+	return nil
+}
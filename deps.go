@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"collect/pkg/collect"
+)
+
+// goDependency is a package of a module in the module cache.
+type goDependency struct {
+	module, version string
+	// pkg is the package's directory within the module, "." for its root.
+	pkg string
+	// dir is where the module is in the module cache.
+	dir string
+}
+
+// mountPath is where the package's files appear in the collection, named
+// after the module cache's layout.
+func (d goDependency) mountPath() string {
+	return d.module + "@" + d.version
+}
+
+// moduleCache returns the directory modules are downloaded to.
+func moduleCache() (string, error) {
+	out, err := exec.Command("go", "env", "GOMODCACHE").Output()
+	if dir := strings.TrimSpace(string(out)); err == nil && dir != "" {
+		return dir, nil
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "go", "pkg", "mod"), nil
+}
+
+// escapeModulePath encodes a module path as the module cache names it on
+// disk, with each upper-case letter written as ! and its lower case.
+func escapeModulePath(p string) string {
+	var b strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// requiredModules returns the versions of the modules the go.mod in dir
+// requires, or none if there is no go.mod.
+func requiredModules(dir string) map[string]string {
+	required := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return required
+	}
+	inBlock := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == "require" && len(fields) >= 3:
+			required[fields[1]] = fields[2]
+		case inBlock && len(fields) >= 2:
+			required[fields[0]] = fields[1]
+		}
+	}
+	return required
+}
+
+// compareVersions orders two semantic versions such as v1.9.1 by their
+// numbers, and pre-releases before their release.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]string, string) {
+		v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "+")
+		v, pre, _ := strings.Cut(v, "-")
+		return strings.Split(v, "."), pre
+	}
+	an, apre := split(a)
+	bn, bpre := split(b)
+	for i := 0; i < max(len(an), len(bn)); i++ {
+		var x, y int
+		if i < len(an) {
+			x, _ = strconv.Atoi(an[i])
+		}
+		if i < len(bn) {
+			y, _ = strconv.Atoi(bn[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+	return strings.Compare(apre, bpre)
+}
+
+// cachedVersions lists the versions of module in the module cache, oldest
+// first.
+func cachedVersions(cache, module string) []string {
+	escaped := escapeModulePath(module)
+	entries, err := os.ReadDir(filepath.Join(cache, filepath.FromSlash(path.Dir(escaped))))
+	if err != nil {
+		return nil
+	}
+	var versions []string
+	for _, entry := range entries {
+		if version, ok := strings.CutPrefix(entry.Name(), path.Base(escaped)+"@"); ok && entry.IsDir() {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	return versions
+}
+
+// findDependency locates the package named by spec, an import path with an
+// optional @version, in the module cache. The module is the longest prefix
+// of the path that go.mod requires or the cache holds. The version may be a
+// prefix, such as v1.9 for the latest v1.9.x; without one, the version
+// go.mod requires is taken, or else the latest in the cache.
+func findDependency(cache, spec string, required map[string]string) (goDependency, error) {
+	pkgPath, version, _ := strings.Cut(spec, "@")
+	for module := pkgPath; module != "." && module != "/"; module = path.Dir(module) {
+		versions := cachedVersions(cache, module)
+		if _, ok := required[module]; !ok && len(versions) == 0 {
+			continue
+		}
+		wanted := version
+		if wanted == "" {
+			wanted = required[module]
+		}
+		chosen := ""
+		for _, v := range versions {
+			if wanted == "" || v == wanted || strings.HasPrefix(v, wanted+".") || strings.HasPrefix(v, wanted+"-") {
+				chosen = v
+			}
+		}
+		if chosen == "" {
+			if wanted == "" {
+				wanted = "latest"
+			}
+			return goDependency{}, fmt.Errorf("%s@%s is not in the module cache; run go mod download %s@%s", module, wanted, module, wanted)
+		}
+		dep := goDependency{module: module, version: chosen, pkg: ".", dir: filepath.Join(cache, filepath.FromSlash(escapeModulePath(module))+"@"+chosen)}
+		if rest := strings.TrimPrefix(pkgPath, module); rest != "" {
+			dep.pkg = strings.TrimPrefix(rest, "/")
+		}
+		if info, err := os.Stat(filepath.Join(dep.dir, filepath.FromSlash(dep.pkg))); err != nil || !info.IsDir() {
+			return goDependency{}, fmt.Errorf("%s has no package %s", dep.mountPath(), pkgPath)
+		}
+		return dep, nil
+	}
+	return goDependency{}, fmt.Errorf("no module providing %s in go.mod or the module cache", pkgPath)
+}
+
+// importedPackages lists the packages outside the standard library and the
+// module itself that the Go files below roots in fsys import, leaving out
+// tests and the directories Go ignores.
+func importedPackages(fsys fs.FS, roots []string, required map[string]string) []string {
+	seen := make(map[string]bool)
+	fset := token.NewFileSet()
+	for _, root := range roots {
+		fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			name := d.Name()
+			if d.IsDir() {
+				if p != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if path.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+				return nil
+			}
+			src, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return nil
+			}
+			parsed, err := parser.ParseFile(fset, p, src, parser.ImportsOnly)
+			if err != nil {
+				return nil
+			}
+			for _, spec := range parsed.Imports {
+				if imported, err := strconv.Unquote(spec.Path.Value); err == nil {
+					seen[imported] = true
+				}
+			}
+			return nil
+		})
+	}
+	var imports []string
+	for imported := range seen {
+		first, _, _ := strings.Cut(imported, "/")
+		if !strings.Contains(first, ".") {
+			continue // the standard library
+		}
+		for module := imported; module != "."; module = path.Dir(module) {
+			if _, ok := required[module]; ok {
+				imports = append(imports, imported)
+				break
+			}
+		}
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// addDependencies mounts the packages named by specs into fsys, returning
+// it with the Go files of each package, tests left out, to add to the
+// collection.
+func addDependencies(fsys fs.FS, specs []string, cache string, required map[string]string) (fs.FS, []string, error) {
+	var files []string
+	mounted := make(map[string]bool)
+	added := make(map[string]bool)
+	for _, spec := range specs {
+		dep, err := findDependency(cache, spec, required)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !mounted[dep.mountPath()] {
+			mounted[dep.mountPath()] = true
+			fsys = collect.Mount(fsys, dep.mountPath(), collect.DirFS(dep.dir))
+		}
+		entries, err := os.ReadDir(filepath.Join(dep.dir, filepath.FromSlash(dep.pkg)))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if file := path.Join(dep.mountPath(), dep.pkg, name); !entry.IsDir() && path.Ext(name) == ".go" && !strings.HasSuffix(name, "_test.go") && !added[file] {
+				added[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	return fsys, files, nil
+}
@@ -2,9 +2,15 @@ module collect
 
 go 1.22.1
 
-require github.com/pkoukk/tiktoken-go v0.1.7
+require (
+	github.com/bmatcuk/doublestar/v4 v4.6.1
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/pkoukk/tiktoken-go v0.1.7
+	github.com/pkoukk/tiktoken-go-loader v0.0.2
+)
 
 require (
 	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"collect/pkg/collect"
+)
+
+// recentHistory returns the last n commits touching roots in the git
+// repository at dir, each with its short hash, date, author and message.
+func recentHistory(dir string, n int, roots []string) (string, error) {
+	args := append([]string{"-C", dir, "log", "-n", strconv.Itoa(n), "--date=short", "--format=%h %ad %an%n%B%x00", "--"}, roots...)
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", err
+	}
+	var commits []string
+	for _, commit := range strings.Split(string(out), "\x00") {
+		if commit = strings.TrimSpace(commit); commit != "" {
+			commits = append(commits, commit)
+		}
+	}
+	return strings.Join(commits, "\n\n"), nil
+}
+
+// blameSummary describes the history of each collected file in the git
+// repository at dir, from git blame: when and in which commit it last
+// changed, and who wrote its lines. Files git does not track are left out.
+func blameSummary(dir string, files []collect.FileStat) string {
+	var b strings.Builder
+	for _, stat := range files {
+		out, err := exec.Command("git", "-C", dir, "blame", "--line-porcelain", "--", stat.Path).Output()
+		if err != nil {
+			continue
+		}
+		type commit struct {
+			summary string
+			time    int64
+		}
+		commits := make(map[string]*commit)
+		lines := make(map[string]int) // per author
+		total := 0
+		var latest, hash string
+		for _, line := range strings.Split(string(out), "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch {
+			case len(key) == 40 && value != "":
+				hash = key
+				if commits[hash] == nil {
+					commits[hash] = &commit{}
+				}
+			case key == "author":
+				if strings.Trim(hash, "0") == "" {
+					value = "uncommitted changes"
+				}
+				lines[value]++
+				total++
+			case key == "author-time":
+				commits[hash].time, _ = strconv.ParseInt(value, 10, 64)
+				if latest == "" || commits[hash].time > commits[latest].time {
+					latest = hash
+				}
+			case key == "summary":
+				commits[hash].summary = value
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		authors := make([]string, 0, len(lines))
+		for author := range lines {
+			authors = append(authors, author)
+		}
+		sort.Slice(authors, func(i, j int) bool {
+			if lines[authors[i]] != lines[authors[j]] {
+				return lines[authors[i]] > lines[authors[j]]
+			}
+			return authors[i] < authors[j]
+		})
+		if len(authors) > 3 {
+			authors = authors[:3]
+		}
+		for i, author := range authors {
+			authors[i] = fmt.Sprintf("%s %d%%", author, lines[author]*100/total)
+		}
+		changed := "has uncommitted changes"
+		if last := commits[latest]; strings.Trim(latest, "0") != "" {
+			changed = fmt.Sprintf("last changed %s in %s %q", time.Unix(last.time, 0).Format("2006-01-02"), latest[:7], last.summary)
+		}
+		fmt.Fprintf(&b, "%s: %s; lines by %s\n", stat.Path, changed, strings.Join(authors, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"collect/pkg/collect"
+)
+
+// starterConfig returns the .collect.toml that collect init writes: an
+// include list of the extensions of the languages making up at least 1% of
+// the collected tokens, most tokens first, and the patterns of the project's
+// .gitignore as the ignore list. The include list is returned with it.
+func starterConfig(stats []collect.FileStat, gitignore []string) (string, []string) {
+	tokensByLanguage := map[string]int{}
+	extensions := map[string]map[string]bool{}
+	total := 0
+	for _, stat := range stats {
+		if stat.Status != collect.StatusCollected {
+			continue
+		}
+		total += stat.Tokens
+		if stat.Language == "" {
+			continue
+		}
+		tokensByLanguage[stat.Language] += stat.Tokens
+		// Files such as Dockerfile are known by name rather than extension.
+		ext := strings.ToLower(path.Ext(stat.Path))
+		if ext == "" {
+			ext = path.Base(stat.Path)
+		}
+		if extensions[stat.Language] == nil {
+			extensions[stat.Language] = map[string]bool{}
+		}
+		extensions[stat.Language][ext] = true
+	}
+	languages := make([]string, 0, len(tokensByLanguage))
+	for language := range tokensByLanguage {
+		if tokensByLanguage[language]*100 >= total {
+			languages = append(languages, language)
+		}
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if tokensByLanguage[languages[i]] != tokensByLanguage[languages[j]] {
+			return tokensByLanguage[languages[i]] > tokensByLanguage[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
+	var include []string
+	for _, language := range languages {
+		exts := make([]string, 0, len(extensions[language]))
+		for ext := range extensions[language] {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		include = append(include, exts...)
+	}
+	// -ignore has no way to re-include what a pattern ignored.
+	var ignore []string
+	for _, pattern := range gitignore {
+		if !strings.HasPrefix(pattern, "!") {
+			ignore = append(ignore, pattern)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Settings for collect, written by collect init. Keys are the flag names\n")
+	b.WriteString("# (see collect -help); flags given on the command line override them.\n\n")
+	if summary := primaryLanguages(stats, len(languages)); summary != "" {
+		fmt.Fprintf(&b, "# The project is %s.\n", summary)
+	}
+	if len(include) > 0 {
+		fmt.Fprintf(&b, "include = %s\n", tomlArray(include))
+	}
+	if len(ignore) > 0 {
+		b.WriteString("# From .gitignore, so that the patterns also apply with gitignore = false.\n")
+		fmt.Fprintf(&b, "ignore = %s\n", tomlArray(ignore))
+	}
+	fmt.Fprintf(&b, "max-tokens = %d\n", collect.DefaultMaxTokens)
+	b.WriteString("\n# Select a profile with -profile docs; it overrides the settings above.\n")
+	b.WriteString("# [profiles.docs]\n")
+	b.WriteString("# include = [\".md\"]\n")
+	return b.String(), include
+}
+
+// tomlArray writes values as a single-line TOML array of strings.
+func tomlArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// writeStarterConfig writes the config collect init creates to path,
+// refusing to replace an existing one.
+func writeStarterConfig(path, content string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"collect/pkg/collect"
+)
+
+// maxCandidates is how many of the largest files resolveOverBudget offers.
+const maxCandidates = 20
+
+// budgetChoice is what to do with a file offered by resolveOverBudget.
+type budgetChoice struct {
+	stat    collect.FileStat
+	dropped bool
+	// limit, if positive, is the number of tokens the file is cut to.
+	limit int
+}
+
+// saved is how many tokens the choice takes off the collection.
+func (b budgetChoice) saved() int {
+	switch {
+	case b.dropped:
+		return b.stat.Tokens
+	case b.limit > 0:
+		return b.stat.Tokens - b.limit
+	}
+	return 0
+}
+
+// resolveOverBudget asks, through in and out, which of the largest collected
+// files to drop or truncate to bring a collection of total tokens within
+// budget. It returns the paths to drop and the token limits of the files to
+// cut, and false if the user cancelled.
+func resolveOverBudget(stats []collect.FileStat, total, budget int, in io.Reader, out io.Writer) (map[string]bool, map[string]int, bool, error) {
+	var choices []budgetChoice
+	for _, stat := range stats {
+		if stat.Status == collect.StatusCollected {
+			choices = append(choices, budgetChoice{stat: stat})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].stat.Tokens > choices[j].stat.Tokens })
+	if len(choices) > maxCandidates {
+		choices = choices[:maxCandidates]
+	}
+
+	estimate := func() int {
+		tokens := total
+		for _, choice := range choices {
+			tokens -= choice.saved()
+		}
+		return tokens
+	}
+	// pick parses a file number as listed.
+	pick := func(arg string) (int, error) {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(choices) {
+			return 0, fmt.Errorf("no file %s", arg)
+		}
+		return n - 1, nil
+	}
+
+	fmt.Fprintf(out, "The collection would take %d tokens, %d over -max-tokens %d. The largest files:\n", total, total-budget, budget)
+	scanner := bufio.NewScanner(in)
+	for {
+		for i, choice := range choices {
+			note := ""
+			switch {
+			case choice.dropped:
+				note = "  (dropped)"
+			case choice.limit > 0:
+				note = fmt.Sprintf("  (truncated to %d)", choice.limit)
+			}
+			fmt.Fprintf(out, "  %3d %8d  %s%s\n", i+1, choice.stat.Tokens, choice.stat.Path, note)
+		}
+		if tokens := estimate(); tokens > budget {
+			fmt.Fprintf(out, "Now about %d tokens, %d over; the files that do not fit will be skipped.\n", tokens, tokens-budget)
+		} else {
+			fmt.Fprintf(out, "Now about %d tokens, within the budget.\n", tokens)
+		}
+		fmt.Fprint(out, "Drop files by number (1 3-5), truncate one with t N or t N=tokens, restore one with u N, Enter to collect, q to cancel: ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return nil, nil, false, scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			break
+		}
+		var err error
+		switch fields[0] {
+		case "q":
+			return nil, nil, false, nil
+		case "t", "u":
+			if len(fields) != 2 {
+				err = fmt.Errorf("%s takes one file number", fields[0])
+				break
+			}
+			arg, tokens, hasTokens := strings.Cut(fields[1], "=")
+			var i int
+			if i, err = pick(arg); err != nil {
+				break
+			}
+			if fields[0] == "u" {
+				choices[i].dropped, choices[i].limit = false, 0
+				break
+			}
+			limit := 0
+			if hasTokens {
+				if limit, err = strconv.Atoi(tokens); err != nil || limit <= 0 {
+					err = fmt.Errorf("invalid token count %q", tokens)
+					break
+				}
+			} else {
+				// Cut the file by as much as the collection is over budget
+				// without it.
+				limit = choices[i].stat.Tokens - (estimate() + choices[i].saved() - budget)
+				if limit <= 0 {
+					err = fmt.Errorf("%s is too small to bring the collection within budget; drop files or give t %d=tokens", choices[i].stat.Path, i+1)
+					break
+				}
+			}
+			if limit >= choices[i].stat.Tokens {
+				err = fmt.Errorf("%s already fits in %d tokens", choices[i].stat.Path, limit)
+				break
+			}
+			choices[i].dropped, choices[i].limit = false, limit
+		default:
+			// Drop nothing unless every number is valid.
+			var drop []int
+			for _, field := range fields {
+				from, to, isRange := strings.Cut(field, "-")
+				if !isRange {
+					to = from
+				}
+				var first, last int
+				if first, err = pick(from); err != nil {
+					break
+				}
+				if last, err = pick(to); err != nil {
+					break
+				}
+				for i := first; i <= last; i++ {
+					drop = append(drop, i)
+				}
+			}
+			if err == nil {
+				for _, i := range drop {
+					choices[i].dropped, choices[i].limit = true, 0
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error: %s\n", err)
+		}
+	}
+
+	dropped := make(map[string]bool)
+	limits := make(map[string]int)
+	for _, choice := range choices {
+		if choice.dropped {
+			dropped[choice.stat.Path] = true
+		} else if choice.limit > 0 {
+			limits[choice.stat.Path] = choice.limit
+		}
+	}
+	return dropped, limits, true, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"collect/pkg/collect"
+)
+
+// pickNode is a file or directory in the interactive picker. Directories
+// have children; files carry their token count and selection.
+type pickNode struct {
+	name     string
+	path     string
+	depth    int
+	tokens   int
+	selected bool
+	expanded bool
+	parent   *pickNode
+	children []*pickNode
+}
+
+func (n *pickNode) isDir() bool { return n.children != nil }
+
+// buildPickTree arranges the collected files into a tree with per-directory
+// token totals. Every file starts out selected, which is what collect would
+// take without the picker.
+func buildPickTree(stats []collect.FileStat) *pickNode {
+	root := &pickNode{children: []*pickNode{}, expanded: true, depth: -1}
+	dirs := map[string]*pickNode{".": root}
+	var dirFor func(dir string) *pickNode
+	dirFor = func(dir string) *pickNode {
+		if node, ok := dirs[dir]; ok {
+			return node
+		}
+		parent := dirFor(path.Dir(dir))
+		node := &pickNode{name: path.Base(dir), path: dir, depth: parent.depth + 1, expanded: true, parent: parent, children: []*pickNode{}}
+		parent.children = append(parent.children, node)
+		dirs[dir] = node
+		return node
+	}
+	for _, stat := range stats {
+		parent := dirFor(path.Dir(stat.Path))
+		parent.children = append(parent.children, &pickNode{name: path.Base(stat.Path), path: stat.Path, depth: parent.depth + 1, tokens: stat.Tokens, selected: true, parent: parent})
+		for dir := parent; dir != nil; dir = dir.parent {
+			dir.tokens += stat.Tokens
+		}
+	}
+	var sortChildren func(node *pickNode)
+	sortChildren = func(node *pickNode) {
+		// Directories first, as in most file browsers.
+		sort.SliceStable(node.children, func(i, j int) bool {
+			a, b := node.children[i], node.children[j]
+			if a.isDir() != b.isDir() {
+				return a.isDir()
+			}
+			return a.name < b.name
+		})
+		for _, child := range node.children {
+			if child.isDir() {
+				sortChildren(child)
+			}
+		}
+	}
+	sortChildren(root)
+	return root
+}
+
+// selection returns the selected tokens and files below n.
+func (n *pickNode) selection() (tokens, files int) {
+	if !n.isDir() {
+		if n.selected {
+			return n.tokens, 1
+		}
+		return 0, 0
+	}
+	for _, child := range n.children {
+		t, f := child.selection()
+		tokens += t
+		files += f
+	}
+	return tokens, files
+}
+
+// countFiles returns the number of files below n.
+func (n *pickNode) countFiles() int {
+	if !n.isDir() {
+		return 1
+	}
+	count := 0
+	for _, child := range n.children {
+		count += child.countFiles()
+	}
+	return count
+}
+
+func (n *pickNode) setSelected(selected bool) {
+	n.selected = selected
+	for _, child := range n.children {
+		child.setSelected(selected)
+	}
+}
+
+// selectedPaths records the paths of the selected files below n.
+func (n *pickNode) selectedPaths(paths map[string]bool) {
+	if !n.isDir() {
+		if n.selected {
+			paths[n.path] = true
+		}
+		return
+	}
+	for _, child := range n.children {
+		child.selectedPaths(paths)
+	}
+}
+
+// visible lists the nodes shown on screen: everything below n that is not
+// inside a collapsed directory.
+func (n *pickNode) visible(nodes []*pickNode) []*pickNode {
+	for _, child := range n.children {
+		nodes = append(nodes, child)
+		if child.isDir() && child.expanded {
+			nodes = child.visible(nodes)
+		}
+	}
+	return nodes
+}
+
+// stty runs stty against the terminal, since this is the one place collect
+// needs raw input and a dependency for it is not worth it.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the rows and columns of the terminal, falling back to
+// 24x80 when stty cannot tell.
+func terminalSize(tty *os.File) (int, int) {
+	var rows, cols int
+	if size, err := stty(tty, "size"); err == nil {
+		fmt.Sscanf(size, "%d %d", &rows, &cols)
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// pickFiles shows the collected files as a tree on the terminal and lets the
+// user choose which of them to keep, with live token totals against budget
+// (0 for none). It returns the chosen paths in walk order, and false if the
+// user cancelled.
+func pickFiles(stats []collect.FileStat, budget int) ([]string, bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, false, fmt.Errorf("-interactive needs a terminal: %w", err)
+	}
+	defer tty.Close()
+
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read the terminal settings: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, false, fmt.Errorf("could not switch the terminal to raw mode: %w", err)
+	}
+	// Use the alternate screen so the picker does not end up in scrollback.
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+		stty(tty, saved)
+	}()
+
+	root := buildPickTree(stats)
+	total := root.countFiles()
+	cursor, offset := 0, 0
+	key := make([]byte, 8)
+	for {
+		nodes := root.visible(nil)
+		rows, cols := terminalSize(tty)
+		listRows := max(1, rows-3)
+		cursor = min(max(cursor, 0), len(nodes)-1)
+		if cursor < offset {
+			offset = cursor
+		} else if cursor >= offset+listRows {
+			offset = cursor - listRows + 1
+		}
+
+		var screen strings.Builder
+		screen.WriteString("\x1b[H\x1b[2J")
+		tokens, files := root.selection()
+		status := fmt.Sprintf("Selected: %d of %d files, %d tokens", files, total, tokens)
+		if budget > 0 {
+			status += fmt.Sprintf(" of %d", budget)
+			if tokens > budget {
+				// Red, since the collection would be cut at the budget.
+				status = "\x1b[31m" + status + " (over budget)\x1b[0m"
+			}
+		}
+		screen.WriteString(status + "\r\n\r\n")
+		for i := offset; i < len(nodes) && i < offset+listRows; i++ {
+			node := nodes[i]
+			mark := "[ ]"
+			if _, count := node.selection(); count == node.countFiles() {
+				mark = "[x]"
+			} else if count > 0 {
+				mark = "[-]"
+			}
+			name := node.name
+			if node.isDir() {
+				arrow := "▸ "
+				if node.expanded {
+					arrow = "▾ "
+				}
+				name = arrow + name + "/"
+			} else {
+				name = "  " + name
+			}
+			line := fmt.Sprintf("%s%s %s  %d", strings.Repeat("  ", node.depth), mark, name, node.tokens)
+			if runes := []rune(line); len(runes) > cols {
+				line = string(runes[:cols])
+			}
+			if i == cursor {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			}
+			screen.WriteString(line + "\r\n")
+		}
+		screen.WriteString(fmt.Sprintf("\x1b[%d;1H", rows))
+		screen.WriteString("↑/↓ move  ←/→ collapse/expand  space toggle  a all/none  enter confirm  q cancel")
+		fmt.Fprint(tty, screen.String())
+
+		n, err := tty.Read(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(nodes) == 0 {
+			return []string{}, true, nil
+		}
+		node := nodes[cursor]
+		switch string(key[:n]) {
+		case "\x1b[A", "k":
+			cursor--
+		case "\x1b[B", "j":
+			cursor++
+		case "\x1b[5~":
+			cursor -= listRows
+		case "\x1b[6~":
+			cursor += listRows
+		case "\x1b[C", "l":
+			if node.isDir() {
+				node.expanded = true
+			}
+		case "\x1b[D", "h":
+			if node.isDir() && node.expanded {
+				node.expanded = false
+			} else if node.parent != root {
+				for i, candidate := range nodes {
+					if candidate == node.parent {
+						cursor = i
+					}
+				}
+			}
+		case " ":
+			if _, count := node.selection(); node.isDir() {
+				node.setSelected(count < node.countFiles())
+			} else {
+				node.selected = !node.selected
+			}
+		case "a":
+			_, count := root.selection()
+			root.setSelected(count < total)
+		case "\r", "\n":
+			selected := make(map[string]bool)
+			root.selectedPaths(selected)
+			paths := []string{}
+			for _, stat := range stats {
+				if selected[stat.Path] {
+					paths = append(paths, stat.Path)
+				}
+			}
+			return paths, true, nil
+		case "q", "\x1b", "\x03":
+			return nil, false, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package collect
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// assignAliases adds to aliases a placeholder name for each of the files
+// and the directories above them that has none: "dir_01" for directories
+// and "file_01.go" for files, keeping the extension, numbered in order after
+// the placeholders already there.
+func assignAliases(aliases map[string]string, files []string) {
+	next := map[string]int{"dir": 1, "file": 1}
+	for _, alias := range aliases {
+		kind, number, _ := strings.Cut(strings.TrimSuffix(alias, path.Ext(alias)), "_")
+		if n, err := strconv.Atoi(number); err == nil {
+			next[kind] = max(next[kind], n+1)
+		}
+	}
+	name := func(p, kind string) {
+		if _, ok := aliases[p]; ok {
+			return
+		}
+		aliases[p] = fmt.Sprintf("%s_%02d", kind, next[kind])
+		if kind == "file" {
+			aliases[p] += path.Ext(p)
+		}
+		next[kind]++
+	}
+	for _, p := range files {
+		for i, c := range p {
+			if c == '/' {
+				name(p[:i], "dir")
+			}
+		}
+		name(p, "file")
+	}
+}
+
+// name returns how the document refers to the file or directory at p: by
+// its path, or by the placeholders of AnonymizePaths.
+func (f formatter) name(p string) string {
+	if f.aliases == nil {
+		return p
+	}
+	parts := strings.Split(p, "/")
+	end := 0
+	for i, part := range parts {
+		end += len(part)
+		if alias, ok := f.aliases[p[:end]]; ok {
+			parts[i] = alias
+		}
+		end++
+	}
+	return strings.Join(parts, "/")
+}
+
+// label is how the file is named in its header: its name, followed by the
+// lines collected if only some were.
+func (f formatter) label(s FileStat) string {
+	if s.Range == "" {
+		return f.name(s.Path)
+	}
+	return f.name(s.Path) + ":" + s.Range
+}
+
+// named returns files with their paths as the document refers to them.
+func (f formatter) named(files []FileStat) []FileStat {
+	if f.aliases == nil {
+		return files
+	}
+	renamed := make([]FileStat, len(files))
+	for i, stat := range files {
+		renamed[i] = stat
+		renamed[i].Path = f.name(stat.Path)
+	}
+	return renamed
+}
@@ -0,0 +1,137 @@
+package collect
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenArchive reads a zip, tar, gzip- or bzip2-compressed tar archive into
+// memory and returns its files as a file system to pass to Collect, so that
+// the walk and every filter work on it as on a directory. The format is
+// detected from the content rather than the name. Links and other special
+// entries of tar archives are left out.
+func OpenArchive(name string) (fs.FS, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")) {
+		return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(data, []byte("BZh")):
+		r = bzip2.NewReader(r)
+	}
+	fsys := memFS{".": {name: ".", mode: fs.ModeDir | 0755}}
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a zip or tar archive: %w", name, err)
+		}
+		p := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if !fs.ValidPath(p) || p == "." {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			fsys.dir(p).modTime = header.ModTime
+		case tar.TypeReg:
+			content, err := io.ReadAll(archive)
+			if err != nil {
+				return nil, err
+			}
+			fsys.dir(path.Dir(p))
+			fsys[p] = &memFile{name: path.Base(p), data: content, mode: header.FileInfo().Mode().Perm(), modTime: header.ModTime}
+		}
+	}
+	for p, file := range fsys {
+		if p != "." {
+			parent := fsys[path.Dir(p)]
+			parent.entries = append(parent.entries, fs.FileInfoToDirEntry(file))
+		}
+	}
+	for _, file := range fsys {
+		sort.Slice(file.entries, func(i, j int) bool { return file.entries[i].Name() < file.entries[j].Name() })
+	}
+	return fsys, nil
+}
+
+// memFS is a read-only file system held in memory, keyed by slash-separated
+// path, with the root at ".".
+type memFS map[string]*memFile
+
+// memFile is a file or directory of a memFS; it is its own fs.FileInfo.
+type memFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	entries []fs.DirEntry
+}
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() any           { return nil }
+
+// dir returns the directory at p, creating it and its parents if needed.
+func (m memFS) dir(p string) *memFile {
+	if file, ok := m[p]; ok && file.IsDir() {
+		return file
+	}
+	m.dir(path.Dir(p))
+	file := &memFile{name: path.Base(p), mode: fs.ModeDir | 0755}
+	m[p] = file
+	return file
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	file, ok := m[name]
+	if !fs.ValidPath(name) || !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openMemFile{memFile: file, Reader: bytes.NewReader(file.data)}, nil
+}
+
+func (m memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, ok := m[name]
+	if !fs.ValidPath(name) || !ok || !file.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry{}, file.entries...), nil
+}
+
+// openMemFile is a memFile opened for reading.
+type openMemFile struct {
+	*memFile
+	*bytes.Reader
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f.memFile, nil }
+func (f *openMemFile) Close() error               { return nil }
+
+// Size resolves the ambiguity between memFile.Size and bytes.Reader.Size.
+func (f *openMemFile) Size() int64 { return f.memFile.Size() }
@@ -0,0 +1,63 @@
+package collect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Budget limits the tokens of the files matching Pattern, a doublestar
+// pattern such as "internal/**"; a plain directory, such as "docs", stands
+// for everything below it.
+type Budget struct {
+	Pattern   string
+	MaxTokens int
+}
+
+// BudgetUsage is how much of a Budget a collection used.
+type BudgetUsage struct {
+	Budget
+	Tokens int
+	Files  int
+	// Skipped counts the files matching the budget that were left out to
+	// keep within it or within MaxTokens.
+	Skipped int
+}
+
+// ParseBudgets parses budgets written as comma-separated pattern=tokens
+// pairs, such as "internal/**=20000,docs/**=5000".
+func ParseBudgets(s string) ([]Budget, error) {
+	var budgets []Budget
+	for _, rule := range strings.Split(s, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		i := strings.LastIndex(rule, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("budget %q is not pattern=tokens", rule)
+		}
+		tokens, err := strconv.Atoi(strings.TrimSpace(rule[i+1:]))
+		if err != nil || tokens <= 0 {
+			return nil, fmt.Errorf("budget %q needs a positive number of tokens", rule)
+		}
+		budgets = append(budgets, Budget{Pattern: strings.TrimSpace(rule[:i]), MaxTokens: tokens})
+	}
+	return budgets, nil
+}
+
+// budgetFor returns the index of the first of budgets that p counts
+// against, or -1 if none does.
+func budgetFor(budgets []Budget, p string) int {
+	for i, budget := range budgets {
+		pattern := strings.TrimSuffix(slashPattern(budget.Pattern), "/")
+		if matched, _ := doublestar.Match(pattern, p); matched {
+			return i
+		}
+		if matched, _ := doublestar.Match(pattern+"/**", p); matched {
+			return i
+		}
+	}
+	return -1
+}
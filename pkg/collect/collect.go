@@ -0,0 +1,1860 @@
+// Package collect gathers the files of a directory tree into a single
+// document sized for an LLM prompt: it applies ignore rules, skips binary and
+// oversized files, formats each file and keeps the total within a token
+// budget.
+//
+// Collect reads only through the fs.FS it is given, so the tree can come
+// from os.DirFS, an archive opened with OpenArchive, a git worktree or an
+// fstest.MapFS in tests. Only LoadGitignores and LoadGitattributes look at
+// the disk, for the rules that live outside the collected tree.
+package collect
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultMaxTokens is the token budget of a Collector returned by New.
+const DefaultMaxTokens = 50000
+
+// DefaultMaxFileSize is the size above which a Collector returned by New
+// skips files.
+const DefaultMaxFileSize = 1 * 1024 * 1024
+
+// File statuses reported in FileStat.Status.
+const (
+	StatusCollected          = "collected"
+	StatusSkippedBinary      = "skipped-binary"
+	StatusSkippedSize        = "skipped-size"
+	StatusSkippedBudget      = "skipped-budget"
+	StatusSkippedInterrupted = "skipped-interrupted"
+	StatusSkippedSecret      = "skipped-secret"
+	StatusSkippedGenerated   = "skipped-generated"
+	StatusError              = "error"
+
+	// Statuses of files rejected by the walk filters, before any reading.
+	StatusIgnored     = "ignored"
+	StatusNotIncluded = "not-included"
+	StatusNotModified = "not-modified-since"
+)
+
+// DefaultIgnorePatterns are the version control, dependency, build and
+// binary artifacts that are never worth sending to a model, followed by
+// those of the platform collect runs on.
+var DefaultIgnorePatterns = append([]string{
+	".git", ".svn", ".hg",
+	"node_modules", "venv", ".venv", "env", "__pycache__", "target",
+	".env", ".env.*",
+	"build", "dist", "out",
+	".idea", ".vscode", ".settings",
+	"*.log", "*.tmp", "*.swp",
+	"*.exe", "*.dll", "*.so", "*.bin", "*.class", "*.jar", "*.war",
+	"*.jpg", "*.jpeg", "*.png", "*.gif", "*.mp3", "*.mp4",
+	"*.zip", "*.tar", "*.gz", "*.7z", "*.rar",
+	"_build", "site",
+}, platformIgnorePatterns[runtime.GOOS]...)
+
+// platformIgnorePatterns are the default ignore patterns that only hold on
+// some platforms. .NET builds into bin and obj, which on Windows are rarely
+// anything else, while elsewhere bin often holds scripts worth reading.
+var platformIgnorePatterns = map[string][]string{
+	"windows": {"bin", "obj", "Thumbs.db", "desktop.ini", "*.pdb", "*.lnk"},
+	"darwin":  {".DS_Store"},
+}
+
+// DefaultGeneratedPatterns are lockfiles and generated artifacts, which are
+// large and rarely useful in a prompt.
+var DefaultGeneratedPatterns = []string{
+	"package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb",
+	"go.sum", "Cargo.lock", "Gemfile.lock", "composer.lock", "poetry.lock", "Pipfile.lock",
+	"*.min.js", "*.min.css", "*.map",
+	"*.pb.go", "*.pb.gw.go", "*_pb2.py", "*_pb2_grpc.py", "*.g.dart", "*.freezed.dart",
+}
+
+// DefaultIgnoreFiles are the ignore files read besides .gitignore: the
+// generic .ignore that ripgrep and other tools share, and .collectignore for
+// exclusions specific to collect, which takes precedence.
+var DefaultIgnoreFiles = []string{".ignore", ".collectignore"}
+
+// Policies for files over MaxFileSize, accepted in Collector.LargeFiles.
+const (
+	LargeFilesSkip     = "skip"
+	LargeFilesTruncate = "truncate"
+	LargeFilesInclude  = "include"
+)
+
+// DefaultPriorityPatterns rank files for the token budget: the READMEs,
+// manifests and entry points that explain a project come first, tests come
+// last, and "*" stands for every other file.
+var DefaultPriorityPatterns = []string{
+	"README*", "readme*",
+	"go.mod", "package.json", "Cargo.toml", "pyproject.toml", "setup.py", "pom.xml", "build.gradle",
+	"main.*", "index.*", "app.*", "__main__.py", "cmd/",
+	"*",
+	"*_test.go", "*_test.py", "test_*.py", "*.test.*", "*.spec.*",
+	"test/", "tests/", "__tests__/", "spec/", "testdata/",
+}
+
+// defaultJobs is the number of files read and tokenized concurrently when
+// Jobs is not set.
+const defaultJobs = 10
+
+// fileJob asks a worker to read the file at index in the walk order.
+type fileJob struct {
+	index int
+	path  string
+	// explicit is set for files named as roots.
+	explicit bool
+}
+
+// fileResult is a worker's outcome for a fileJob, including the messages it
+// would have logged, which the collector writes out in walk order.
+type fileResult struct {
+	index    int
+	stat     FileStat
+	content  string
+	messages string
+	// text is the content before formatting, kept to truncate the file if
+	// it does not fit the budget.
+	text string
+}
+
+// Collector collects the files of a file system. The zero value collects
+// everything with no limits; New returns one with the command line defaults.
+type Collector struct {
+	// Roots are the directories and files to collect, as slash-separated
+	// paths in the file system. Files named here bypass the filters. Empty
+	// means the whole file system.
+	Roots []string
+
+	// Files, if not nil, lists the candidate files as slash-separated paths,
+	// in the order to collect them, instead of walking the roots. Listed files
+	// outside the roots are left out, and the rest still go through the
+	// filters.
+	Files []string
+	// Include restricts collection to files matching one of the patterns:
+	// a glob or name ending such as ".go" matched against the file name, or
+	// a doublestar glob such as "src/**/*.ts" matched against the path if it
+	// contains a slash. Empty includes every file.
+	Include []string
+	// Ignore lists the patterns of files and directories to leave out, with
+	// the semantics of .gitignore patterns.
+	Ignore []string
+	// IncludeRegexps, if not empty, further restricts collection to files
+	// whose slash-separated path matches one of them, and files and
+	// directories whose path matches one of IgnoreRegexps are left out.
+	IncludeRegexps []*regexp.Regexp
+	IgnoreRegexps  []*regexp.Regexp
+	// IsOutput, if set, reports whether the file at a slash-separated path is
+	// one the run writes, such as the document or a report, which is left
+	// out so that a collection never takes in its own earlier output.
+	IsOutput func(path string) bool
+	// Gitignore, if not nil, holds the rules of the git repository around
+	// the file system. The .gitignore files found during the walk are added
+	// to a copy of it.
+	Gitignore *Gitignore
+	// IgnoreFiles lists the names of files with .gitignore syntax, such as
+	// .collectignore, read in every directory of the walk to keep out what
+	// should stay in git but not in the collection. Later names take
+	// precedence within a directory. They apply whether Gitignore is set or
+	// not, and a "!" in them cannot re-include what .gitignore ignores.
+	IgnoreFiles []string
+	// Gitattributes, if not nil, skips the files that .gitattributes marks
+	// linguist-vendored, or linguist-generated when SkipGenerated is set.
+	// Like Gitignore, the .gitattributes files found during the walk are
+	// added to a copy of it.
+	Gitattributes *Gitattributes
+	// Extract lists the document formats, of Extractors, whose files are
+	// collected as the text extracted from them rather than as binary
+	// files. MaxFileSize does not apply to them, and ExtractTokens, if
+	// positive, instead cuts the text of each down to that many tokens.
+	// Notebooks are reduced to the source of their cells; KeepOutputs also
+	// keeps the text the cells output, such as printed results and
+	// tracebacks, though never the images.
+	Extract       []string
+	ExtractTokens int
+	KeepOutputs   bool
+	// Placeholders collects the binary files, and the large files that
+	// LargeFiles skips, as a one-line description with their size and type,
+	// such as "[binary file, 2.3 MB, image/png]", so that the document still
+	// shows they exist.
+	Placeholders bool
+	// MaxDepth, if positive, limits the collection to the files at most
+	// that many levels below a root: 1 collects only the files directly in
+	// it. Hidden collects the files and directories whose name starts with
+	// a dot, which are otherwise left out; the ignore patterns, such as
+	// .git, apply either way. Paths named as roots are exempt from both.
+	MaxDepth int
+	Hidden   bool
+	// FollowSymlinks collects the files symbolic links point to and walks
+	// the directories they point to, rather than leaving links out. Links
+	// that would lead around in circles, or to a directory already
+	// collected through another link, are still left out, and so are links
+	// leading outside the file system unless AllowOutsideRoot is set; only
+	// a LinkFS, such as DirFS, can tell where its links lead.
+	FollowSymlinks   bool
+	AllowOutsideRoot bool
+	// ModifiedSince, if positive, skips files not modified within it.
+	ModifiedSince time.Duration
+	// ModifiedAfter, if set, skips files last modified before it.
+	ModifiedAfter time.Time
+	// SkipGenerated skips files whose first lines carry a code generator's
+	// notice, such as Go's "Code generated ... DO NOT EDIT.", or that
+	// .gitattributes marks linguist-generated. Files named as roots are
+	// collected regardless.
+	SkipGenerated bool
+	// Fast only reads files with a known text extension and skips the
+	// binary check.
+	Fast bool
+	// TextExtensions are always treated as text and BinaryExtensions as
+	// binary, without looking at the content.
+	TextExtensions   []string
+	BinaryExtensions []string
+
+	// MaxTokens is the token budget for the whole collection; 0 means
+	// unlimited.
+	MaxTokens int
+	// Truncate, if set, is the strategy for collecting part of a file
+	// rather than skipping it: one of TruncateHead, TruncateTail,
+	// TruncateHeadTail or TruncateMiddleOut. Files whose content exceeds
+	// TruncateTokens, if positive, are cut to that many tokens, and a file
+	// that does not fit the rest of the budget is cut to fit it.
+	Truncate       string
+	TruncateTokens int
+	// FileTokens caps the files at the given paths at a number of tokens
+	// each, as TruncateTokens does for every file, cutting them with
+	// Truncate, or TruncateHead if unset.
+	FileTokens map[string]int
+	// GoOrder collects the Go files of a module so that each package comes
+	// before the packages that import it, as found from their imports and
+	// go.mod, so that definitions precede their uses. ImportGraph adds an
+	// "Import Graph" section listing the packages each package of the module
+	// imports. Files in other languages keep their places.
+	GoOrder     bool
+	ImportGraph bool
+	// Priority ranks the files for the budget, so that when it runs out
+	// the files left out are the least important ones. Files matching an
+	// earlier pattern are taken first; a "*" entry places the files no
+	// pattern matches, which otherwise come last. The output keeps the
+	// collection order regardless.
+	Priority []string
+	// Budgets share out MaxTokens between subtrees, so that no subtree can
+	// starve the rest: a file counts against the first budget whose pattern
+	// matches it, and is left out, or cut with Truncate, once it would take
+	// that budget over its limit. Result.Budgets reports their use.
+	Budgets []Budget
+	// MaxFileSize is the size above which files are large; 0 means
+	// unlimited. LargeFiles decides what happens to them: they are skipped
+	// (LargeFilesSkip, the default), cut to MaxFileSize bytes with the
+	// Truncate strategy, head if unset (LargeFilesTruncate), or collected
+	// like any other file (LargeFilesInclude).
+	MaxFileSize int64
+	LargeFiles  string
+
+	// ExpandTabs, if positive, converts leading tabs to that many spaces.
+	ExpandTabs int
+	// Encoding is the text encoding files are decoded from before they are
+	// counted: EncodingAuto (the default if empty) detects UTF-16 and
+	// Latin-1 files, which are transcoded to UTF-8, while the others force
+	// one encoding on every file.
+	Encoding string
+	// NormalizeEOL converts CRLF and CR line endings to LF and ends every
+	// file with a newline. Otherwise content is kept byte for byte.
+	NormalizeEOL bool
+	// TrimTrailing strips trailing whitespace from every line.
+	TrimTrailing bool
+	// Outline reduces source files in supported languages to their
+	// declarations and signatures, dropping the implementation. Outlined
+	// files are not annotated by ChangedLines, since their lines no longer
+	// match the file's.
+	Outline bool
+	// StripComments removes the comments from files in languages with a
+	// known comment syntax, and StripBlankLines removes the empty lines of
+	// every file. Files that lose lines are not annotated by ChangedLines.
+	// The tokens saved are reported in FileStat.Saved.
+	StripComments   bool
+	StripBlankLines bool
+	// MinifyData compacts JSON, YAML and XML files: JSON loses its
+	// insignificant whitespace, YAML its comments and blank lines, and XML
+	// the whitespace between tags. SampleArrays, if positive, also keeps only
+	// that many elements of longer JSON arrays and YAML sequences, noting how
+	// many there were. The tokens saved are reported in FileStat.Saved.
+	MinifyData   bool
+	SampleArrays int
+	// StripLicenseHeaders removes the copyright and license comment at the
+	// top of files, which is often the same in every file of a project. A
+	// "License Headers" section after the contents notes the files it was
+	// removed from, by license. The tokens saved are reported in
+	// FileStat.Saved.
+	StripLicenseHeaders bool
+	// Dedup collects each distinct content once: a file whose content is
+	// byte for byte that of a file collected before it is collected as a
+	// line naming that file instead, and its FileStat.DuplicateOf is set.
+	Dedup bool
+	// Filter, if set, transforms each file's content before it is counted.
+	// On error the original content is kept.
+	Filter func(path, content string) (string, error)
+	// Ranges limits the files at the given paths to a range of their lines,
+	// and Symbols limits Go files to the declarations of the named symbols,
+	// as matched by findSymbols, leaving out the files declaring none. The
+	// file header notes the lines collected.
+	Ranges  map[string]LineRange
+	Symbols []string
+	// Baseline maps paths to the SHA-256 hash of their content at an earlier
+	// collection. Files whose content still has that hash are left out, with
+	// StatusNotModified, so that only what was added or changed is collected.
+	Baseline map[string]string
+	// LineNumbers prefixes every line with its number, so that answers can
+	// refer to lines precisely. The numbers match the file's unless
+	// Outline, StripComments, StripBlankLines, MinifyData or
+	// StripLicenseHeaders removed lines.
+	LineNumbers bool
+	// ChangedLines, if set, returns the line numbers of a file that changed,
+	// which are then prefixed with "+ " and the other lines with "  ".
+	ChangedLines func(path string) (map[int]bool, error)
+	// Secrets, if set, scans each file for credentials such as API keys
+	// and private keys after Filter, and then redacts them (SecretsRedact),
+	// skips the file (SecretsSkip) or fails the collection (SecretsFail).
+	Secrets string
+	// RedactPII masks the personal details in each file after the secret
+	// scan: email addresses become [EMAIL], phone numbers [PHONE] and IP
+	// addresses other than loopback ones [IP].
+	RedactPII bool
+
+	// Format is one of Formats; empty means FormatText.
+	Format string
+	// FileHeader is written before each file in FormatText, with the path
+	// substituted for its single %s. FileSeparator is written after it.
+	FileHeader    string
+	FileSeparator string
+	// Tree is the layout of the file tree placed before the contents, one
+	// of TreeFlat, TreeTree or TreeNone; empty means TreeFlat. TreeTokens
+	// adds the token counts of files and directories to it.
+	Tree       string
+	TreeTokens bool
+	// Sections are placed after the file contents, in order. FileSections,
+	// if set, is called with the files collected and returns more sections
+	// to place after them, such as summaries of the files' history; an error
+	// fails the collection.
+	Sections     []Section
+	FileSections func(files []FileStat) ([]Section, error)
+	// Prepend and Append are prompt text placed before and after the
+	// document, each separated from it by a blank line. Template, if set,
+	// lays out the document around the collected files instead. Either
+	// way, the prompt's tokens count against MaxTokens.
+	Prepend  string
+	Append   string
+	Template *template.Template
+	// WrapStart and WrapEnd are placed around the whole document, prompt
+	// included.
+	WrapStart string
+	WrapEnd   string
+	// Root names the collected directory in manifests and JSON output.
+	Root string
+	// AnonymizePaths names the files and directories in the document by
+	// placeholders, such as dir_01/file_03.go, keeping the real names out of
+	// it; the Result and log messages still use the real paths. PathAliases
+	// maps real paths to the placeholder of their last element. Collect adds
+	// the paths it is missing, numbered after those already there, so passing
+	// the same map again keeps the names stable across collections.
+	AnonymizePaths bool
+	PathAliases    map[string]string
+
+	// Chunks, if positive, additionally splits the collection into that
+	// many parts of similar size. ChunkTokens, if positive, instead splits
+	// it into as many parts as needed to keep each within that many tokens.
+	// Either way, each part is a complete document with its own file tree.
+	Chunks      int
+	ChunkTokens int
+
+	// CountOnly counts the files without keeping their contents or building
+	// the Output and Parts, for when only the statistics are needed.
+	CountOnly bool
+	// Writer, if set, receives the document instead of Result.Output, which
+	// is left empty. Unless a Template, FormatJSON or splitting needs the
+	// whole document at once, it is written piece by piece, so that a large
+	// collection is held in memory once rather than copied into one string.
+	Writer io.Writer
+	// Jobs is the number of files read and tokenized at once; 0 means 10.
+	Jobs int
+
+	// Tokenizer counts tokens; nil means the gpt-4o encoding.
+	Tokenizer Tokenizer
+	// Log receives progress and skip messages; nil discards them.
+	Log io.Writer
+}
+
+// New returns a Collector with the defaults of the collect command.
+func New() *Collector {
+	return &Collector{
+		Ignore:        append(append([]string{}, DefaultIgnorePatterns...), DefaultGeneratedPatterns...),
+		Gitignore:     &Gitignore{},
+		IgnoreFiles:   DefaultIgnoreFiles,
+		Gitattributes: &Gitattributes{},
+		SkipGenerated: true,
+		Placeholders:  true,
+		Extract:       []string{ExtractPDF, ExtractDOCX, ExtractNotebook},
+		ExtractTokens: DefaultExtractTokens,
+		MaxTokens:     DefaultMaxTokens,
+		Priority:      DefaultPriorityPatterns,
+		MaxFileSize:   DefaultMaxFileSize,
+		Format:        FormatText,
+		Tree:          TreeTree,
+		FileHeader:    "File: %s\n",
+		FileSeparator: "\n",
+		Root:          ".",
+	}
+}
+
+// FileStat records what happened to a single candidate file.
+type FileStat struct {
+	Path     string
+	Bytes    int64
+	Lines    int
+	Tokens   int
+	Saved    int // tokens removed by StripComments, StripBlankLines, MinifyData and StripLicenseHeaders
+	Language string
+	Status   string
+	Reason   string
+	Content  string // only kept for FormatJSON and FormatHTML
+	// Truncated is set when only part of the file was collected.
+	Truncated bool
+	// Range lists the lines collected, such as "100-250", when Ranges or
+	// Symbols selected part of the file.
+	Range string
+	// Placeholder is set when a binary or large file was collected as a
+	// one-line description instead of its content.
+	Placeholder bool
+	// License names the license whose header StripLicenseHeaders removed,
+	// such as "Apache-2.0", or "other".
+	License string
+	// DuplicateOf is the path of the file whose content Dedup found this
+	// file's identical to.
+	DuplicateOf string
+	// Hash is the hex SHA-256 hash of the file's content as read, before any
+	// decoding; it is empty for files that were not read, such as binaries.
+	Hash string
+}
+
+// Result is the outcome of a collection.
+type Result struct {
+	// Root is the Collector's Root.
+	Root string
+	// Output is the complete document in the selected format.
+	Output string
+	// FileTree lists the candidate files in the Collector's Tree layout.
+	FileTree string
+	// Files holds the candidate files that passed the walk filters and
+	// Filtered the files and directories the filters rejected.
+	Files    []FileStat
+	Filtered []FileStat
+
+	// Parts holds the split documents when Chunks or ChunkTokens is set.
+	Parts []Part
+	// Budgets reports the use of the Collector's Budgets, in order.
+	Budgets []BudgetUsage
+
+	// TotalTokens includes the tokens of WrapStart and WrapEnd.
+	TotalTokens int
+	TotalBytes  int
+	TotalFiles  int
+}
+
+// Collect walks the roots in fsys and assembles their files into a document.
+// If ctx is cancelled, the files already being read are finished and the
+// partial result is returned together with ctx.Err().
+func (c *Collector) Collect(ctx context.Context, fsys fs.FS) (Result, error) {
+	result := Result{Root: c.Root}
+	format := c.Format
+	if format == "" {
+		format = FormatText
+	}
+	if !isValidFormat(format) {
+		return result, fmt.Errorf("unknown format %q (expected %s)", format, strings.Join(Formats, ", "))
+	}
+	for _, budget := range c.Budgets {
+		if !doublestar.ValidatePattern(slashPattern(budget.Pattern)) {
+			return result, fmt.Errorf("invalid budget pattern %q", budget.Pattern)
+		}
+		result.Budgets = append(result.Budgets, BudgetUsage{Budget: budget})
+	}
+	header := c.FileHeader
+	if format == FormatText && (strings.Count(header, "%s") != 1 || strings.Count(header, "%") != 1) {
+		return result, fmt.Errorf("file header must contain exactly one %%s and no other %% verbs")
+	}
+	switch c.Secrets {
+	case "", SecretsRedact, SecretsSkip, SecretsFail:
+	default:
+		return result, fmt.Errorf("unknown secrets mode %q (expected %s, %s or %s)", c.Secrets, SecretsRedact, SecretsSkip, SecretsFail)
+	}
+	switch c.LargeFiles {
+	case "", LargeFilesSkip, LargeFilesTruncate, LargeFilesInclude:
+	default:
+		return result, fmt.Errorf("unknown large file policy %q (expected %s, %s or %s)", c.LargeFiles, LargeFilesSkip, LargeFilesTruncate, LargeFilesInclude)
+	}
+	switch c.Truncate {
+	case "", TruncateHead, TruncateTail, TruncateHeadTail, TruncateMiddleOut:
+	default:
+		return result, fmt.Errorf("unknown truncation strategy %q (expected %s, %s, %s or %s)", c.Truncate, TruncateHead, TruncateTail, TruncateHeadTail, TruncateMiddleOut)
+	}
+	for _, name := range c.Extract {
+		if _, ok := extractors[name]; !ok {
+			return result, fmt.Errorf("unknown extractor %q (expected %s, %s, %s or %s)", name, ExtractPDF, ExtractDOCX, ExtractHTML, ExtractNotebook)
+		}
+	}
+	switch c.Tree {
+	case "", TreeFlat, TreeTree, TreeNone:
+	default:
+		return result, fmt.Errorf("unknown tree layout %q (expected %s, %s or %s)", c.Tree, TreeFlat, TreeTree, TreeNone)
+	}
+	switch c.Encoding {
+	case "", EncodingAuto, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1:
+	default:
+		return result, fmt.Errorf("unknown encoding %q (expected %s, %s, %s, %s or %s)", c.Encoding, EncodingAuto, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1)
+	}
+	if c.Chunks > 0 && c.ChunkTokens > 0 {
+		return result, fmt.Errorf("split into a number of chunks or by chunk size, not both")
+	}
+	if c.Template != nil && (c.Chunks > 0 || c.ChunkTokens > 0) {
+		return result, fmt.Errorf("a template lays out a single document and cannot be split")
+	}
+	tokenizer := c.Tokenizer
+	if tokenizer == nil {
+		var err error
+		if tokenizer, err = NewTokenizer("gpt-4o"); err != nil {
+			return result, err
+		}
+	}
+	roots := c.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	log := c.Log
+	if log == nil {
+		log = io.Discard
+	}
+	gitignoreRules := c.Gitignore.clone()
+	var ignoreFileRules *Gitignore
+	if len(c.IgnoreFiles) > 0 {
+		ignoreFileRules = &Gitignore{names: c.IgnoreFiles}
+	}
+	attributes := c.Gitattributes.clone()
+	linguistAttrs := []string{attrVendored}
+	if c.SkipGenerated {
+		linguistAttrs = append(linguistAttrs, attrGenerated)
+	}
+	formatter := formatter{format: format, header: header, separator: c.FileSeparator, sections: c.Sections, tree: c.Tree != TreeNone}
+
+	var files []string
+	seen := make(map[string]bool)
+	isRoot := make(map[string]bool, len(roots))
+	for _, root := range roots {
+		isRoot[path.Clean(root)] = true
+	}
+	cutoff := time.Now().Add(-c.ModifiedSince)
+
+	// keepFile applies the file filters, recording why a file was rejected.
+	keepFile := func(p string, info func() (fs.FileInfo, error)) (bool, error) {
+		if c.IsOutput != nil && c.IsOutput(p) {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: "is written by collect"})
+			return false, nil
+		}
+		if pattern, ignored := matchIgnorePattern(p, false, c.Ignore); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("matches ignore pattern %q", pattern)})
+			return false, nil
+		}
+		if ignored, rule := gitignoreRules.match(p, false); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("matches .gitignore rule %q", rule)})
+			return false, nil
+		}
+		if ignored, rule := ignoreFileRules.match(p, false); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("matches %s rule %q", strings.Join(c.IgnoreFiles, " or "), rule)})
+			return false, nil
+		}
+		if attr, rule := attributes.match(p, linguistAttrs); attr != "" {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("marked %s by .gitattributes line %q", attr, rule)})
+			return false, nil
+		}
+
+		if re, ignored := matchRegexps(p, c.IgnoreRegexps); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("matches ignore regexp %q", re)})
+			return false, nil
+		}
+
+		if !isIncluded(p, c.Include) {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusNotIncluded, Reason: "matches no include pattern"})
+			return false, nil
+		}
+		if _, included := matchRegexps(p, c.IncludeRegexps); len(c.IncludeRegexps) > 0 && !included {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusNotIncluded, Reason: "matches no include regexp"})
+			return false, nil
+		}
+
+		if c.Fast && !c.isKnownTextFile(p) {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusNotIncluded, Reason: "not a known text file type (fast mode)"})
+			return false, nil
+		}
+
+		if c.ModifiedSince > 0 || !c.ModifiedAfter.IsZero() {
+			info, err := info()
+			if err != nil {
+				return false, err
+			}
+			if c.ModifiedSince > 0 && info.ModTime().Before(cutoff) {
+				result.Filtered = append(result.Filtered, FileStat{Path: p, Bytes: info.Size(), Status: StatusNotModified, Reason: fmt.Sprintf("not modified in the last %s", c.ModifiedSince)})
+				return false, nil
+			}
+			if info.ModTime().Before(c.ModifiedAfter) {
+				result.Filtered = append(result.Filtered, FileStat{Path: p, Bytes: info.Size(), Status: StatusNotModified, Reason: fmt.Sprintf("not modified since %s", c.ModifiedAfter.Format("2006-01-02 15:04"))})
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	// loadRules reads the .gitignore, ignore files and .gitattributes of dir.
+	loadRules := func(dir string) error {
+		if err := gitignoreRules.loadDir(fsys, dir); err != nil {
+			return err
+		}
+		if err := ignoreFileRules.loadDir(fsys, dir); err != nil {
+			return err
+		}
+		return attributes.loadDir(fsys, dir)
+	}
+
+	// loadGitignoreDirs reads the .gitignore, ignore files and
+	// .gitattributes from the file system root down to dir, so that they
+	// apply to paths below dir.
+	loadGitignoreDirs := func(dir string) {
+		dirs := []string{dir}
+		for dir != "." {
+			dir = path.Dir(dir)
+			dirs = append(dirs, dir)
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if err := loadRules(dirs[i]); err != nil {
+				fmt.Fprintln(log, "Error:", err)
+			}
+		}
+	}
+
+	// ignoreDir applies the directory filters, recording why dir was left
+	// out.
+	ignoreDir := func(p string) bool {
+		if pattern, ignored := matchIgnorePattern(p, true, c.Ignore); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("directory matches ignore pattern %q", pattern)})
+			return true
+		}
+		if re, ignored := matchRegexps(p, c.IgnoreRegexps); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("directory matches ignore regexp %q", re)})
+			return true
+		}
+		if ignored, rule := gitignoreRules.match(p, true); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("directory matches .gitignore rule %q", rule)})
+			return true
+		}
+		if ignored, rule := ignoreFileRules.match(p, true); ignored {
+			result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: fmt.Sprintf("directory matches %s rule %q", strings.Join(c.IgnoreFiles, " or "), rule)})
+			return true
+		}
+		return false
+	}
+
+	// outOfReach applies MaxDepth and Hidden to p, whose path below its
+	// root is rel, recording why it was left out.
+	outOfReach := func(p, rel string, dir bool) bool {
+		reason := ""
+		depth := strings.Count(rel, "/") + 1
+		switch {
+		case !c.Hidden && isHidden(rel) && dir:
+			reason = "hidden directory"
+		case !c.Hidden && isHidden(rel):
+			reason = "hidden file"
+		case c.MaxDepth > 0 && dir && depth >= c.MaxDepth:
+			// Its files would all be deeper than the limit.
+			reason = fmt.Sprintf("directory at the depth limit of %d", c.MaxDepth)
+		case c.MaxDepth > 0 && depth > c.MaxDepth:
+			reason = fmt.Sprintf("beyond the depth limit of %d", c.MaxDepth)
+		default:
+			return false
+		}
+		result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: reason})
+		return true
+	}
+
+	// followed holds the directories entered through symbolic links, so
+	// that two links to one directory do not collect it twice.
+	var followed []fs.FileInfo
+	// skipLink applies the symbolic link policy to the link at p, recording
+	// why it was not followed. info describes what it points to.
+	skipLink := func(p string, info fs.FileInfo) bool {
+		reason := ""
+		if !c.FollowSymlinks {
+			reason = "symbolic link, not followed"
+		}
+		if reason == "" && info.IsDir() {
+			// A link to a directory the walk is inside of would lead
+			// around in circles.
+			for dir := path.Dir(p); reason == ""; dir = path.Dir(dir) {
+				if ancestor, err := fs.Stat(fsys, dir); err == nil && os.SameFile(ancestor, info) {
+					reason = fmt.Sprintf("symbolic link to %s, which contains it", dir)
+				}
+				if dir == "." {
+					break
+				}
+			}
+		}
+		if linkFS, ok := fsys.(LinkFS); reason == "" && ok {
+			target, err := resolveLink(linkFS, p)
+			switch {
+			case err == errOutsideRoot && c.AllowOutsideRoot:
+			case err != nil:
+				reason = "symbolic link that " + err.Error()
+			case info.IsDir() && withinRoots(target, roots):
+				reason = fmt.Sprintf("symbolic link to %s, which is collected anyway", target)
+			}
+		} else if reason == "" && !c.AllowOutsideRoot {
+			reason = "symbolic link that cannot be checked to stay inside the root"
+		}
+		if reason == "" && info.IsDir() {
+			for _, dir := range followed {
+				if os.SameFile(dir, info) {
+					reason = "symbolic link to a directory already collected through another link"
+					break
+				}
+			}
+		}
+		if reason == "" {
+			return false
+		}
+		fmt.Fprintf(log, "Skipping %s: %s\n", p, reason)
+		result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: reason})
+		return true
+	}
+
+	// walkRoot walks root, whose path below the root it was reached from is
+	// rel: "." unless it is a directory a link leads to.
+	var walkRoot func(root, rel string) error
+	walkRoot = func(root, rel string) error {
+		return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			pathRel := path.Join(rel, strings.TrimPrefix(p, root+"/"))
+			if root == "." {
+				pathRel = path.Join(rel, p)
+			}
+
+			// Roots named explicitly are taken as given, links or not.
+			if d.Type()&fs.ModeSymlink != 0 && p != root {
+				info, err := fs.Stat(fsys, p)
+				if err != nil {
+					fmt.Fprintf(log, "Skipping broken symbolic link: %s\n", p)
+					result.Filtered = append(result.Filtered, FileStat{Path: p, Status: StatusIgnored, Reason: "broken symbolic link"})
+					return nil
+				}
+				if skipLink(p, info) || info.IsDir() && (ignoreDir(p) || outOfReach(p, pathRel, true)) {
+					return nil
+				}
+				if info.IsDir() {
+					followed = append(followed, info)
+					if err := walkRoot(p, pathRel); err != nil && ctx.Err() == nil {
+						fmt.Fprintln(log, "Error:", err)
+					}
+					return nil
+				}
+			} else if d.IsDir() {
+				if p == root {
+					return loadRules(p)
+				}
+				if ignoreDir(p) || outOfReach(p, pathRel, true) {
+					return fs.SkipDir
+				}
+				return loadRules(p)
+			}
+
+			if seen[p] {
+				return nil
+			}
+
+			// Files named explicitly as roots skip the filters.
+			if p != root {
+				if keep, err := keepFile(p, d.Info); !keep {
+					return err
+				}
+				if outOfReach(p, pathRel, false) {
+					return nil
+				}
+			}
+
+			seen[p] = true
+			files = append(files, p)
+			return nil
+		})
+	}
+
+	if c.Files != nil {
+		for _, p := range c.Files {
+			p = path.Clean(p)
+			if ctx.Err() != nil {
+				break
+			}
+			if seen[p] || !withinRoots(p, roots) {
+				continue
+			}
+			info, err := fs.Stat(fsys, p)
+			if err != nil {
+				// Listed files may have been deleted since, as in a diff.
+				if !errors.Is(err, fs.ErrNotExist) {
+					fmt.Fprintln(log, "Error:", err)
+				}
+				continue
+			}
+			if info.IsDir() {
+				continue
+			}
+			loadGitignoreDirs(path.Dir(p))
+			// A listed file is reached through a link if it, or a directory
+			// above it, is one.
+			if linkFS, ok := fsys.(LinkFS); ok && !isRoot[p] {
+				if resolved, err := resolveLink(linkFS, p); (err != nil || resolved != p) && skipLink(p, info) {
+					continue
+				}
+			}
+			if !isRoot[p] {
+				keep, err := keepFile(p, func() (fs.FileInfo, error) { return info, nil })
+				if err != nil {
+					fmt.Fprintln(log, "Error:", err)
+				}
+				if !keep || outOfReach(p, belowRoots(p, roots), false) {
+					continue
+				}
+			}
+			seen[p] = true
+			files = append(files, p)
+		}
+	} else {
+		for _, root := range roots {
+			root = path.Clean(root)
+			// The .gitignore files between the file system root and a
+			// nested root still apply.
+			if root != "." {
+				loadGitignoreDirs(path.Dir(root))
+			}
+
+			err := walkRoot(root, ".")
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintln(log, "Error:", err)
+			}
+		}
+	}
+
+	if c.AnonymizePaths {
+		if c.PathAliases == nil {
+			c.PathAliases = make(map[string]string)
+		}
+		assignAliases(c.PathAliases, files)
+		formatter.aliases = c.PathAliases
+	}
+
+	if c.GoOrder || c.ImportGraph {
+		imports := goImports(fsys, files)
+		if c.GoOrder {
+			files = orderGoFiles(files, imports)
+		}
+		if graph := formatter.importGraph(files, imports); c.ImportGraph && graph != "" {
+			formatter.sections = append(slices.Clip(formatter.sections), Section{Name: "Import Graph", Content: graph})
+		}
+	}
+
+	// Files are read and budgeted in priority order, and put back into
+	// collection order once the budget has been applied.
+	order := make(map[string]int, len(files))
+	if len(c.Priority) > 0 {
+		ranks := make(map[string]int, len(files))
+		for i, p := range files {
+			order[p] = i
+			ranks[p] = priorityRank(p, c.Priority)
+		}
+		sort.SliceStable(files, func(i, j int) bool { return ranks[files[i]] < ranks[files[j]] })
+	}
+
+	// The files are handed to the workers by a producer, and the collector
+	// below assembles their results in walk order, so the output and the
+	// budget decisions do not depend on which worker finishes first. Only the
+	// collector touches the result and the log.
+	workCtx, stopWork := context.WithCancel(ctx)
+	defer stopWork()
+
+	jobs := make(chan fileJob)
+	go func() {
+		defer close(jobs)
+		for i, p := range files {
+			if workCtx.Err() != nil {
+				return
+			}
+			select {
+			case jobs <- fileJob{index: i, path: p, explicit: isRoot[p]}:
+			case <-workCtx.Done():
+				return
+			}
+		}
+	}()
+
+	results := make(chan fileResult)
+	var wg sync.WaitGroup
+	workers := c.Jobs
+	if workers <= 0 {
+		workers = defaultJobs
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// A file handed out just before the work was stopped is
+				// left unread; the collector accounts for it.
+				if workCtx.Err() != nil {
+					continue
+				}
+				var messages strings.Builder
+				content, text, stat, err := c.processFile(fsys, job.path, job.explicit, formatter, tokenizer, &messages)
+				if err != nil {
+					fmt.Fprintf(&messages, "Error processing file %s: %s\n", job.path, err)
+					stat.Status = StatusError
+					stat.Reason = err.Error()
+				}
+				if c.Truncate == "" {
+					text = ""
+				}
+				results <- fileResult{index: job.index, stat: stat, content: content, messages: messages.String(), text: text}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// The prompt is part of every document, so the files get what is left
+	// of the budget.
+	promptTokens, err := c.promptTokens(tokenizer)
+	if err != nil {
+		return result, err
+	}
+	result.TotalTokens = promptTokens
+
+	// No file costs less than its header, so once the room left is smaller
+	// than an empty one's, the budget is provably exhausted and the files
+	// not read yet are skipped unread, without stat, read or tokenizer.
+	minFileTokens := max(1, tokenizer.Count(formatter.file("", "", "")))
+	exhausted := func() bool {
+		return c.MaxTokens > 0 && c.MaxTokens-result.TotalTokens < minFileTokens
+	}
+
+	var collected []fileResult
+	budgetReached := false
+	var secretErr error
+	// firstWithHash maps the hashes of the files collected in full to the
+	// first of them, for Dedup.
+	firstWithHash := make(map[string]string)
+	assemble := func(r fileResult) {
+		io.WriteString(log, r.messages)
+		stat := r.stat
+		hash := stat.Hash + " " + stat.Range
+		if first, ok := firstWithHash[hash]; ok && c.Dedup && stat.Status == StatusCollected && stat.Hash != "" {
+			r.text = "[identical to " + formatter.name(first) + "]\n"
+			r.content = formatter.file(formatter.label(stat), "", r.text)
+			stat.Tokens = tokenizer.Count(r.content)
+			stat.DuplicateOf = first
+		}
+		// A file that does not fit takes what is left of the budget if it
+		// can be truncated. The budget is MaxTokens or, if less is left of
+		// it, that of the file's subtree.
+		room, limit := c.MaxTokens-result.TotalTokens, "token limit"
+		var bucket *BudgetUsage
+		if i := budgetFor(c.Budgets, stat.Path); i >= 0 {
+			bucket = &result.Budgets[i]
+			if bucketRoom := bucket.MaxTokens - bucket.Tokens; c.MaxTokens == 0 || bucketRoom < room {
+				room, limit = bucketRoom, "the budget for "+bucket.Pattern
+			}
+		}
+		if c.Truncate != "" && stat.Status == StatusCollected && secretErr == nil && !budgetReached &&
+			(c.MaxTokens > 0 || bucket != nil) && stat.Tokens > room && room >= minTruncatedTokens {
+			if content, tokens, ok := c.truncateToFit(stat, r.text, room, formatter, tokenizer); ok {
+				fmt.Fprintf(log, "Truncated %s from %d to %d tokens to stay within %s.\n", stat.Path, stat.Tokens, tokens, limit)
+				r.content, stat.Tokens, stat.Truncated = content, tokens, true
+			}
+		}
+		switch {
+		case secretErr != nil:
+			return
+		case stat.Status == StatusSkippedSecret && c.Secrets == SecretsFail:
+			secretErr = fmt.Errorf("%s %s", stat.Path, stat.Reason)
+			stopWork()
+			return
+		case budgetReached || exhausted():
+			if !budgetReached {
+				fmt.Fprintln(log, "Reached maximum token limit.")
+				budgetReached = true
+			}
+			stat.Status = StatusSkippedBudget
+			stat.Reason = "token limit already reached"
+		case stat.Status != StatusCollected:
+		case bucket != nil && bucket.Tokens+stat.Tokens > bucket.MaxTokens:
+			fmt.Fprintf(log, "Skipping file %s to stay within the budget for %s.\n", stat.Path, bucket.Pattern)
+			stat.Status = StatusSkippedBudget
+			stat.Reason = fmt.Sprintf("%d tokens would exceed the budget of %d for %s", stat.Tokens, bucket.MaxTokens, bucket.Pattern)
+			bucket.Skipped++
+		case c.MaxTokens == 0 || result.TotalTokens+stat.Tokens <= c.MaxTokens:
+			result.TotalTokens += stat.Tokens
+			if bucket != nil {
+				bucket.Tokens += stat.Tokens
+				bucket.Files++
+			}
+			if r.content != "" {
+				result.TotalBytes += len(r.content)
+				result.TotalFiles++
+			}
+			if stat.DuplicateOf != "" {
+				fmt.Fprintf(log, "Collected %s as identical to %s\n", stat.Path, stat.DuplicateOf)
+			} else if stat.Hash != "" && !stat.Truncated {
+				firstWithHash[hash] = stat.Path
+			}
+			if c.CountOnly {
+				break
+			}
+			if format == FormatJSON || format == FormatHTML {
+				stat.Content = r.content
+			}
+			collected = append(collected, fileResult{stat: stat, content: r.content})
+		default:
+			fmt.Fprintf(log, "Skipping file %s to stay within token limit.\n", stat.Path)
+			stat.Status = StatusSkippedBudget
+			stat.Reason = fmt.Sprintf("%d tokens would exceed the limit of %d", stat.Tokens, c.MaxTokens)
+			if bucket != nil {
+				bucket.Skipped++
+			}
+		}
+		result.Files = append(result.Files, stat)
+	}
+
+	// Results for the files handed out always form a prefix of the walk
+	// order once the workers are done, so next ends up at the first file
+	// that was never read.
+	pending := make(map[int]fileResult)
+	next := 0
+	for r := range results {
+		pending[r.index] = r
+		for r, ok := pending[next]; ok; r, ok = pending[next] {
+			delete(pending, next)
+			assemble(r)
+			next++
+		}
+		if exhausted() {
+			stopWork()
+		}
+	}
+	if secretErr != nil {
+		return result, secretErr
+	}
+	for _, p := range files[next:] {
+		stat := FileStat{Path: p, Language: languageForPath(p)}
+		if ctx.Err() != nil && !budgetReached && !exhausted() {
+			stat.Status = StatusSkippedInterrupted
+			stat.Reason = "run was interrupted"
+			result.Files = append(result.Files, stat)
+			continue
+		}
+		assemble(fileResult{stat: stat})
+	}
+
+	if len(c.Priority) > 0 {
+		sort.SliceStable(result.Files, func(i, j int) bool { return order[result.Files[i].Path] < order[result.Files[j].Path] })
+		sort.SliceStable(collected, func(i, j int) bool { return order[collected[i].stat.Path] < order[collected[j].stat.Path] })
+	}
+	if c.FileSections != nil {
+		var files []FileStat
+		for _, stat := range result.Files {
+			if stat.Status == StatusCollected {
+				files = append(files, stat)
+			}
+		}
+		sections, err := c.FileSections(files)
+		if err != nil {
+			return result, err
+		}
+		formatter.sections = append(slices.Clip(formatter.sections), sections...)
+	}
+	if note := licenseNote(result.Files); note != "" {
+		formatter.sections = append(slices.Clip(formatter.sections), Section{Name: "License Headers", Content: note})
+	}
+	result.TotalTokens += c.wrapTokens(tokenizer) + tokenizer.Count(formatter.renderSections())
+	result.FileTree = buildFileTree(formatter.named(result.Files), c.Tree, c.TreeTokens)
+	if c.CountOnly {
+		return result, ctx.Err()
+	}
+	if c.Writer != nil && c.Template == nil && format != FormatJSON && format != FormatHTML && c.Chunks == 0 && c.ChunkTokens == 0 {
+		if err := c.writeDocument(c.Writer, formatter, result, collected); err != nil {
+			return result, err
+		}
+		return result, ctx.Err()
+	}
+
+	var collectedContent strings.Builder
+	for _, r := range collected {
+		collectedContent.WriteString(r.content)
+	}
+
+	output, err := formatter.document(result, collectedContent.String())
+	if err != nil {
+		return result, err
+	}
+	if c.Template != nil {
+		root := result.Root
+		if c.AnonymizePaths {
+			root = "."
+		}
+		data := TemplateData{Root: root, FileTree: result.FileTree, Contents: collectedContent.String(), Document: output, TotalTokens: result.TotalTokens, TotalFiles: result.TotalFiles}
+		if output, err = executeTemplate(c.Template, data); err != nil {
+			return result, err
+		}
+	} else {
+		output = c.prependText() + output + c.appendText(output)
+	}
+	result.Output = c.wrap(output)
+	if c.Writer != nil {
+		if _, err := io.WriteString(c.Writer, result.Output); err != nil {
+			return result, err
+		}
+		result.Output = ""
+	}
+
+	if c.Chunks > 0 || c.ChunkTokens > 0 {
+		if result.Parts, err = c.split(result, collected, formatter, tokenizer); err != nil {
+			return result, err
+		}
+	}
+
+	return result, ctx.Err()
+}
+
+// writeDocument writes the document Output would hold to w piece by piece,
+// leaving the collected contents where they are instead of copying them all
+// into one string.
+func (c *Collector) writeDocument(w io.Writer, f formatter, result Result, collected []fileResult) error {
+	out := &tailWriter{w: w}
+	before, after := f.frame(result)
+	out.WriteString(c.wrapStart())
+	out.WriteString(c.prependText())
+	out.WriteString(before)
+	for _, r := range collected {
+		out.WriteString(r.content)
+	}
+	out.WriteString(after)
+	out.WriteString(c.appendText(out.tail))
+	if c.WrapEnd != "" && !strings.HasSuffix(out.tail, "\n") {
+		out.WriteString("\n")
+	}
+	out.WriteString(c.WrapEnd)
+	return out.err
+}
+
+// tailWriter writes to w, keeping the first error and the last two bytes
+// written, which are all appendText and wrap look at.
+type tailWriter struct {
+	w    io.Writer
+	tail string
+	err  error
+}
+
+func (t *tailWriter) WriteString(s string) {
+	if t.err != nil || s == "" {
+		return
+	}
+	_, t.err = io.WriteString(t.w, s)
+	if len(s) >= 2 {
+		t.tail = s[len(s)-2:]
+	} else {
+		t.tail = (t.tail + s)[max(0, len(t.tail)+len(s)-2):]
+	}
+}
+
+// TemplateData is what a Collector's Template is executed with.
+type TemplateData struct {
+	Root     string
+	FileTree string
+	// Contents holds the formatted files, and Document what the output
+	// would be without the template: the file tree, the contents and any
+	// sections.
+	Contents string
+	Document string
+	// TotalTokens and TotalFiles are the totals of the collection.
+	TotalTokens int
+	TotalFiles  int
+}
+
+func executeTemplate(tmpl *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// prependText returns Prepend followed by a blank line.
+func (c *Collector) prependText() string {
+	if c.Prepend == "" {
+		return ""
+	}
+	return strings.TrimRight(c.Prepend, "\n") + "\n\n"
+}
+
+// appendText returns Append preceded by a blank line, for placing it after
+// document.
+func (c *Collector) appendText(document string) string {
+	if c.Append == "" {
+		return ""
+	}
+	text := strings.TrimRight(c.Append, "\n") + "\n"
+	switch {
+	case strings.HasSuffix(document, "\n\n"):
+		return text
+	case strings.HasSuffix(document, "\n"):
+		return "\n" + text
+	default:
+		return "\n\n" + text
+	}
+}
+
+// promptTokens counts the tokens of the prompt placed around the collected
+// files: Prepend and Append, or the text of the Template itself.
+func (c *Collector) promptTokens(tokenizer Tokenizer) (int, error) {
+	if c.Template != nil {
+		text, err := executeTemplate(c.Template, TemplateData{})
+		if err != nil {
+			return 0, err
+		}
+		return tokenizer.Count(text), nil
+	}
+	return tokenizer.Count(c.prependText()) + tokenizer.Count(c.appendText("")), nil
+}
+
+// wrapStart returns WrapStart on a line of its own.
+func (c *Collector) wrapStart() string {
+	if c.WrapStart != "" && !strings.HasSuffix(c.WrapStart, "\n") {
+		return c.WrapStart + "\n"
+	}
+	return c.WrapStart
+}
+
+// wrap places WrapStart and WrapEnd around a document.
+func (c *Collector) wrap(document string) string {
+	if c.WrapEnd != "" && !strings.HasSuffix(document, "\n") {
+		document += "\n"
+	}
+	return c.wrapStart() + document + c.WrapEnd
+}
+
+// wrapTokens counts the tokens wrap adds around a document.
+func (c *Collector) wrapTokens(tokenizer Tokenizer) int {
+	return tokenizer.Count(c.wrapStart()) + tokenizer.Count(c.WrapEnd)
+}
+
+// priorityRank returns the index of the first pattern in priority that p
+// matches, or that of the "*" entry if none does. Patterns match the way
+// Include patterns do.
+func priorityRank(p string, priority []string) int {
+	rest := len(priority)
+	for i, pattern := range priority {
+		if pattern == "*" {
+			rest = i
+			continue
+		}
+		if matchIncludePattern(pattern, p) {
+			return i
+		}
+	}
+	return rest
+}
+
+// matchIgnorePattern returns the first ignore pattern matching p.
+func matchIgnorePattern(p string, isDir bool, ignorePatterns []string) (string, bool) {
+	for _, pattern := range ignorePatterns {
+		if matchPathPattern(pattern, p, isDir) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// matchPathPattern matches a glob pattern against a slash-separated path the
+// way .gitignore does. A pattern without a slash matches any component of
+// the path, so "bin" ignores bin/ and everything below it but not cabinet/.
+// A trailing slash restricts it to directories. A slash anywhere else
+// anchors it to the root, so it is matched against the relative path:
+// "src/generated/" ignores that subtree only and "docs/api/*.md" matches
+// markdown directly inside docs/api. "**" matches any number of
+// directories, as in "**/testdata/**" or "src/**/*.ts".
+func matchPathPattern(pattern, p string, isDir bool) bool {
+	pattern = slashPattern(pattern)
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+
+	segments := strings.Split(p, "/")
+	for i := range segments {
+		if dirOnly && i == len(segments)-1 && !isDir {
+			break
+		}
+		subject := segments[i]
+		if anchored {
+			subject = strings.Join(segments[:i+1], "/")
+		}
+		if matched, _ := doublestar.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// slashPattern lets a pattern written with the platform's separator, such
+// as src\generated on Windows, match the slash-separated paths of the walk.
+// On Windows a backslash therefore cannot escape a wildcard, as with
+// filepath.Match.
+func slashPattern(pattern string) string {
+	if os.PathSeparator == '\\' {
+		return strings.ReplaceAll(pattern, `\`, "/")
+	}
+	return pattern
+}
+
+// matchRegexps returns the first of the regular expressions matching p.
+func matchRegexps(p string, regexps []*regexp.Regexp) (string, bool) {
+	for _, re := range regexps {
+		if re.MatchString(p) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+func isIncluded(p string, includePatterns []string) bool {
+	if len(includePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range includePatterns {
+		if matchIncludePattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIncludePattern matches an include pattern against the path of a
+// file. Patterns containing a slash are matched like ignore patterns, so
+// "src/**/*.ts" and "docs/" work; the others match the base name, as a glob
+// or, without wildcards, as its ending, so ".go" matches every Go file.
+func matchIncludePattern(pattern, p string) bool {
+	pattern = slashPattern(pattern)
+	if strings.Contains(pattern, "/") {
+		return matchPathPattern(pattern, p, false)
+	}
+	name := path.Base(p)
+	if !strings.ContainsAny(pattern, "*?[{") {
+		return strings.HasSuffix(name, pattern)
+	}
+	matched, _ := doublestar.Match(pattern, name)
+	return matched
+}
+
+// hasExtension reports whether the file name ends in one of the extensions.
+// Matching is on the name suffix so multi-part extensions like .pb.go work.
+func hasExtension(p string, extensions []string) bool {
+	name := strings.ToLower(path.Base(p))
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownTextFile reports whether the file has a recognized source or text
+// extension, one listed in TextExtensions, or is a document Extract applies
+// to.
+func (c *Collector) isKnownTextFile(p string) bool {
+	_, document := c.extractorFor(p)
+	return languageForPath(p) != "" || hasExtension(p, c.TextExtensions) || document
+}
+
+// isBinaryFile reports whether the start of a file holds NUL bytes, unless
+// they are those of UTF-16 text in encoding, as detected if it is auto.
+func isBinaryFile(fsys fs.FS, p, encoding string) (bool, error) {
+	file, err := fsys.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 8000)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	if encoding == "" || encoding == EncodingAuto {
+		encoding = detectEncoding(buf[:n])
+	}
+	if isUTF16(encoding) {
+		return false, nil
+	}
+
+	for i := 0; i < n; i++ {
+		if buf[i] == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readText reads the content of a file, decoded to UTF-8 as Encoding says,
+// and counts its lines. The content is kept byte for byte, line endings and
+// a missing final newline included, unless NormalizeEOL, ExpandTabs or
+// TrimTrailing ask for changes. Files are
+// read whole rather than with a bufio.Scanner, which fails on lines over
+// 64KB such as those of minified code and JSONL fixtures.
+func (c *Collector) readText(r io.Reader) (string, int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+	encoding := c.Encoding
+	if encoding == "" || encoding == EncodingAuto {
+		encoding = detectEncoding(data[:min(len(data), 8000)])
+	}
+	text := decodeText(data, encoding)
+	if c.NormalizeEOL {
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+	}
+	lines := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+	if c.ExpandTabs <= 0 && !c.TrimTrailing {
+		return text, lines, nil
+	}
+
+	var body strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		content := strings.TrimSuffix(line, "\n")
+		ending := line[len(content):]
+		if strings.HasSuffix(content, "\r") {
+			content, ending = content[:len(content)-1], "\r"+ending
+		}
+		if c.ExpandTabs > 0 {
+			content = expandLeadingTabs(content, c.ExpandTabs)
+		}
+		if c.TrimTrailing {
+			content = strings.TrimRight(content, " \t")
+		}
+		body.WriteString(content + ending)
+	}
+	return body.String(), lines, nil
+}
+
+// numberLines prefixes each line of text with its number, padded to the
+// width of the last one. The numbers are taken from numbers if it is not
+// nil, where 0 leaves a line unnumbered.
+func numberLines(text string, numbers []int) string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if numbers == nil {
+		numbers = make([]int, len(lines))
+		for i := range numbers {
+			numbers[i] = i + 1
+		}
+	}
+	width := len(strconv.Itoa(max(len(lines), slices.Max(append([]int{0}, numbers...)))))
+	var b strings.Builder
+	for i, line := range lines {
+		if i < len(numbers) && numbers[i] > 0 {
+			fmt.Fprintf(&b, "%*d | %s", width, numbers[i], line)
+		} else {
+			fmt.Fprintf(&b, "%*s | %s", width, "", line)
+		}
+	}
+	return b.String()
+}
+
+// selectedRanges returns the lines of the file at p that Ranges or Symbols
+// select, an empty slice if Symbols select none, or nil to collect it whole.
+func (c *Collector) selectedRanges(p, text string) []LineRange {
+	if r, ok := c.Ranges[p]; ok {
+		return []LineRange{r}
+	}
+	if len(c.Symbols) == 0 {
+		return nil
+	}
+	ranges := findSymbols(p, text, c.Symbols)
+	if ranges == nil {
+		ranges = []LineRange{}
+	}
+	return ranges
+}
+
+// expandLeadingTabs replaces each tab in the line's indentation with width spaces.
+func expandLeadingTabs(line string, width int) string {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	if !strings.Contains(line[:indent], "\t") {
+		return line
+	}
+	return strings.ReplaceAll(line[:indent], "\t", strings.Repeat(" ", width)) + line[indent:]
+}
+
+// readFile reads the text of the file at p, returning it with its number of
+// lines and the hash of its content.
+func (c *Collector) readFile(fsys fs.FS, p string) (string, int, string, error) {
+	file, err := fsys.Open(p)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("Error opening file %s: %s", p, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	text, lines, err := c.readText(io.TeeReader(file, hash))
+	if err != nil {
+		return "", 0, "", fmt.Errorf("Error reading file %s: %s", p, err)
+	}
+	return text, lines, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *Collector) processFile(fsys fs.FS, p string, explicit bool, formatter formatter, tokenizer Tokenizer, log io.Writer) (string, string, FileStat, error) {
+	stat := FileStat{Path: p, Language: languageForPath(p)}
+
+	info, err := fs.Stat(fsys, p)
+	if err != nil {
+		return "", "", stat, fmt.Errorf("Error stating file %s: %s", p, err)
+	}
+	stat.Bytes = info.Size()
+	// placeholder collects the file as a description of what it is.
+	placeholder := func(kind string) (string, string, FileStat, error) {
+		text := fmt.Sprintf("[%s, %s", kind, FormatSize(int(info.Size())))
+		if typ, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(p)), ";"); typ != "" {
+			text += ", " + typ
+		}
+		text += "]\n"
+		content := formatter.file(formatter.name(stat.Path), "", text)
+		stat.Tokens = tokenizer.Count(content)
+		stat.Status = StatusCollected
+		stat.Placeholder = true
+		return content, "", stat, nil
+	}
+	// Documents are collected as the text extracted from them, which is
+	// usually a fraction of their size, so MaxFileSize does not apply.
+	var text string
+	var lineNumber int
+	extracted := false
+	if e, ok := c.extractorFor(p); ok {
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return "", "", stat, fmt.Errorf("Error reading file %s: %s", p, err)
+		}
+		var language string
+		if text, language, err = e.extract(c, data); err != nil {
+			fmt.Fprintf(log, "Could not extract the text of %s: %s\n", p, err)
+		} else {
+			extracted = true
+			sum := sha256.Sum256(data)
+			stat.Hash = hex.EncodeToString(sum[:])
+			stat.Language = language
+			if tokens := tokenizer.Count(text); c.ExtractTokens > 0 && tokens > c.ExtractTokens {
+				if truncated, ok := truncate(text, TruncateHead, c.ExtractTokens, tokenizer); ok {
+					fmt.Fprintf(log, "Truncated the text of %s from %d to at most %d tokens.\n", p, tokens, c.ExtractTokens)
+					text = truncated
+					stat.Truncated = true
+				}
+			}
+			lineNumber = strings.Count(text, "\n")
+		}
+	}
+
+	large := !extracted && c.MaxFileSize > 0 && info.Size() > c.MaxFileSize
+	if large && (c.LargeFiles == "" || c.LargeFiles == LargeFilesSkip) {
+		if c.Placeholders {
+			return placeholder("large file")
+		}
+		fmt.Fprintf(log, "Skipping large file (>%s): %s\n", FormatSize(int(c.MaxFileSize)), p)
+		stat.Status = StatusSkippedSize
+		stat.Reason = fmt.Sprintf("larger than %s", FormatSize(int(c.MaxFileSize)))
+		return "", "", stat, nil
+	}
+
+	isBinary := !extracted && hasExtension(p, c.BinaryExtensions)
+	if !isBinary && !extracted && !c.Fast && !hasExtension(p, c.TextExtensions) {
+		isBinary, err = isBinaryFile(fsys, p, c.Encoding)
+		if err != nil {
+			return "", "", stat, fmt.Errorf("Error checking if file is binary: %s", err)
+		}
+	}
+	if isBinary {
+		if c.Placeholders {
+			return placeholder("binary file")
+		}
+		fmt.Fprintf(log, "Skipping binary file: %s\n", p)
+		stat.Status = StatusSkippedBinary
+		stat.Reason = "binary file"
+		return "", "", stat, nil
+	}
+
+	if !extracted {
+		if text, lineNumber, stat.Hash, err = c.readFile(fsys, p); err != nil {
+			return "", "", stat, err
+		}
+	}
+
+	// The lines of extracted text are not the document's.
+	var changedLines map[int]bool
+	if c.ChangedLines != nil && !extracted {
+		changedLines, err = c.ChangedLines(p)
+		if err != nil {
+			fmt.Fprintf(log, "Could not annotate changes in %s: %s\n", p, err)
+		}
+	}
+	if old, ok := c.Baseline[p]; ok && old == stat.Hash {
+		stat.Status = StatusNotModified
+		stat.Reason = "unchanged since the baseline"
+		return "", "", stat, nil
+	}
+	if c.SkipGenerated && !explicit {
+		if line := generatedLine(text); line > 0 {
+			fmt.Fprintf(log, "Skipping generated file: %s\n", p)
+			stat.Status = StatusSkippedGenerated
+			stat.Reason = fmt.Sprintf("marked as generated on line %d", line)
+			return "", "", stat, nil
+		}
+	}
+	// lineNumbers holds the numbers in the file of the lines of text when
+	// they are not simply counted from 1.
+	var lineNumbers []int
+	if ranges := c.selectedRanges(p, text); ranges != nil {
+		if len(ranges) == 0 {
+			stat.Status = StatusNotIncluded
+			stat.Reason = "declares none of the symbols"
+			return "", "", stat, nil
+		}
+		var labels []string
+		for _, r := range ranges {
+			labels = append(labels, r.String())
+		}
+		stat.Range = strings.Join(labels, ",")
+		text, lineNumbers = selectLines(text, ranges)
+		// Line changes are looked up by the file's own numbers.
+		if changedLines != nil {
+			selected := make(map[int]bool)
+			for i, n := range lineNumbers {
+				if changedLines[n] {
+					selected[i+1] = true
+				}
+			}
+			changedLines = selected
+		}
+	}
+	if large && c.LargeFiles == LargeFilesTruncate {
+		strategy := c.Truncate
+		if strategy == "" {
+			strategy = TruncateHead
+		}
+		if truncated, ok := truncate(text, strategy, int(c.MaxFileSize), byteCounter{}); ok {
+			fmt.Fprintf(log, "Truncated large file (>%s): %s\n", FormatSize(int(c.MaxFileSize)), p)
+			text = truncated
+			stat.Truncated = true
+		}
+	}
+	if outline := outliner(p); c.Outline && outline != nil {
+		outlined, err := outline(p, text)
+		if err != nil {
+			fmt.Fprintf(log, "Could not outline %s, using the full content: %s\n", p, err)
+		} else {
+			text = outlined
+			changedLines, lineNumbers = nil, nil
+		}
+	}
+	if c.StripComments || c.StripBlankLines || c.MinifyData || c.StripLicenseHeaders {
+		stripped := text
+		if c.StripLicenseHeaders {
+			stripped, stat.License = stripLicenseHeader(stat.Language, stripped)
+		}
+		if c.MinifyData {
+			stripped = minifyData(stat.Language, stripped, c.SampleArrays)
+		}
+		if c.StripComments {
+			stripped = stripComments(stat.Language, stripped)
+		}
+		if c.StripBlankLines {
+			stripped = stripBlankLines(stripped)
+		}
+		if strings.Count(stripped, "\n") != strings.Count(text, "\n") {
+			changedLines, lineNumbers = nil, nil
+		}
+		stat.Saved = tokenizer.Count(text) - tokenizer.Count(stripped)
+		text = stripped
+	}
+	if c.Filter != nil {
+		filtered, err := c.Filter(p, text)
+		if err != nil {
+			fmt.Fprintf(log, "Warning: filtering %s failed, using original content: %s\n", p, err)
+		} else {
+			text = filtered
+		}
+	}
+
+	if c.Secrets != "" {
+		if found := findSecrets(text); len(found) > 0 {
+			first := found[0]
+			switch c.Secrets {
+			case SecretsRedact:
+				text = redactSecrets(text, found)
+				fmt.Fprintf(log, "Redacted %d possible secrets in %s\n", len(found), p)
+			default:
+				if c.Secrets == SecretsSkip {
+					fmt.Fprintf(log, "Skipping file %s: possible %s on line %d\n", p, first.kind, first.line)
+				}
+				stat.Status = StatusSkippedSecret
+				stat.Reason = fmt.Sprintf("contains a possible %s on line %d", first.kind, first.line)
+				return "", "", stat, nil
+			}
+		}
+	}
+	if c.RedactPII {
+		if found := findPII(text); len(found) > 0 {
+			text = redactPII(text, found)
+			fmt.Fprintf(log, "Redacted %d possible personal details in %s\n", len(found), p)
+		}
+	}
+
+	if c.LineNumbers {
+		text = numberLines(text, lineNumbers)
+	}
+	if len(changedLines) > 0 {
+		var annotated strings.Builder
+		for i, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				continue
+			}
+			if changedLines[i+1] {
+				annotated.WriteString("+ ")
+			} else {
+				annotated.WriteString("  ")
+			}
+			annotated.WriteString(line)
+		}
+		text = annotated.String()
+	}
+
+	strategy, limit := c.Truncate, c.TruncateTokens
+	if n, ok := c.FileTokens[p]; ok {
+		if strategy == "" {
+			strategy = TruncateHead
+		}
+		if limit <= 0 || n < limit {
+			limit = n
+		}
+	}
+	if strategy != "" && limit > 0 {
+		if tokens := tokenizer.Count(text); tokens > limit {
+			if truncated, ok := truncate(text, strategy, limit, tokenizer); ok {
+				fmt.Fprintf(log, "Truncated %s from %d to at most %d tokens.\n", p, tokens, limit)
+				text = truncated
+				stat.Truncated = true
+			}
+		}
+	}
+
+	fileContent := formatter.file(formatter.label(stat), stat.Language, text)
+
+	stat.Lines = lineNumber
+	stat.Tokens = tokenizer.Count(fileContent)
+	stat.Status = StatusCollected
+
+	return fileContent, text, stat, nil
+}
+
+// withinRoots reports whether p is one of the roots or lies below one.
+func withinRoots(p string, roots []string) bool {
+	for _, root := range roots {
+		root = path.Clean(root)
+		if root == "." || p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// belowRoots returns the part of p below the innermost of roots containing
+// it.
+func belowRoots(p string, roots []string) string {
+	rel := p
+	for _, root := range roots {
+		root = path.Clean(root)
+		if inner := strings.TrimPrefix(p, root+"/"); root != "." && inner != p && len(inner) < len(rel) {
+			rel = inner
+		}
+	}
+	return rel
+}
+
+// isHidden reports whether a slash-separated path names a hidden file or
+// directory, or one within a hidden directory.
+func isHidden(p string) bool {
+	for _, name := range strings.Split(p, "/") {
+		if len(name) > 1 && name[0] == '.' && name != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatSize renders a byte count for humans, e.g. "12 KB".
+func FormatSize(bytes int) string {
+	switch {
+	case bytes < 1024:
+		return fmt.Sprintf("%d B", bytes)
+	case bytes < 1024*1024:
+		return fmt.Sprintf("%d KB", bytes/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	}
+}
@@ -0,0 +1,199 @@
+package collect
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// collected runs c over fsys and returns the paths of the files it collected.
+func collected(t *testing.T, c *Collector, fsys fstest.MapFS) []string {
+	t.Helper()
+	if c.Tokenizer == nil {
+		c.Tokenizer = ApproximateTokenizer{}
+	}
+	result, err := c.Collect(context.Background(), fsys)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	var paths []string
+	for _, stat := range result.Files {
+		if stat.Status == StatusCollected {
+			paths = append(paths, stat.Path)
+		}
+	}
+	return paths
+}
+
+func TestPathPatternsAreAnchored(t *testing.T) {
+	fsys := fstest.MapFS{
+		"src/generated/x":       {Data: []byte("x\n")},
+		"other/src/generated/x": {Data: []byte("x\n")},
+		"docs/api/y.md":         {Data: []byte("# y\n")},
+		"docs/api/v2/z.md":      {Data: []byte("# z\n")},
+		"other/docs/api/y.md":   {Data: []byte("# y\n")},
+	}
+	tests := []struct {
+		name    string
+		ignore  []string
+		include []string
+		want    []string
+	}{
+		{
+			name:   "ignore directory",
+			ignore: []string{"src/generated/"},
+			want:   []string{"docs/api/v2/z.md", "docs/api/y.md", "other/docs/api/y.md", "other/src/generated/x"},
+		},
+		{
+			name:   "ignore glob",
+			ignore: []string{"docs/api/*.md"},
+			want:   []string{"docs/api/v2/z.md", "other/docs/api/y.md", "other/src/generated/x", "src/generated/x"},
+		},
+		{
+			name:   "ignore leading slash",
+			ignore: []string{"/src/generated"},
+			want:   []string{"docs/api/v2/z.md", "docs/api/y.md", "other/docs/api/y.md", "other/src/generated/x"},
+		},
+		{
+			name:   "ignore any component",
+			ignore: []string{"generated"},
+			want:   []string{"docs/api/v2/z.md", "docs/api/y.md", "other/docs/api/y.md"},
+		},
+		{
+			name:   "ignore double star",
+			ignore: []string{"**/api/*.md"},
+			want:   []string{"docs/api/v2/z.md", "other/src/generated/x", "src/generated/x"},
+		},
+		{
+			name:    "include directory",
+			include: []string{"src/generated/"},
+			want:    []string{"src/generated/x"},
+		},
+		{
+			name:    "include glob",
+			include: []string{"docs/api/*.md"},
+			want:    []string{"docs/api/y.md"},
+		},
+		{
+			name:    "include extension",
+			include: []string{".md"},
+			want:    []string{"docs/api/v2/z.md", "docs/api/y.md", "other/docs/api/y.md"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New()
+			c.Ignore = append(c.Ignore, test.ignore...)
+			c.Include = test.include
+			if got := collected(t, c, fsys); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("collected %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCollect(t *testing.T) {
+	files := map[string]string{
+		"README.md":               "# Example\n\nAn example module.\n",
+		"go.mod":                  "module example\n\ngo 1.22\n",
+		"main.go":                 "package main\n\nfunc main() {}\n",
+		"pkg/b.go":                "package pkg\n\nfunc B() int { return 2 }\n",
+		"pkg/a.go":                "package pkg\n\nfunc A() int { return 1 }\n",
+		"pkg/a_test.go":           "package pkg\n\nimport \"testing\"\n\nfunc TestA(t *testing.T) {\n\tif A() != 1 {\n\t\tt.Fatal(\"A\")\n\t}\n}\n",
+		"node_modules/x/index.js": "module.exports = 1\n",
+		"package-lock.json":       "{}\n",
+	}
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	walkOrder := []string{"README.md", "go.mod", "main.go", "pkg/a.go", "pkg/a_test.go", "pkg/b.go"}
+	tokens := func(p string) int {
+		return ApproximateTokenizer{}.Count("File: " + p + "\n" + files[p] + "\n")
+	}
+	all := 0
+	for _, p := range walkOrder {
+		all += tokens(p)
+	}
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		// skipped is the file the budget leaves out, if any.
+		skipped string
+	}{
+		{name: "unlimited"},
+		{name: "within budget", maxTokens: all},
+		// Tests come last in the priority order, so they are the first to go.
+		{name: "over budget", maxTokens: all - 1, skipped: "pkg/a_test.go"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New()
+			c.MaxTokens = test.maxTokens
+			c.Tokenizer = ApproximateTokenizer{}
+			result, err := c.Collect(context.Background(), fsys)
+			if err != nil {
+				t.Fatalf("Collect: %v", err)
+			}
+
+			var paths []string
+			total := 0
+			for _, stat := range result.Files {
+				paths = append(paths, stat.Path)
+				want := StatusCollected
+				if stat.Path == test.skipped {
+					want = StatusSkippedBudget
+				}
+				if stat.Status != want {
+					t.Errorf("%s: status %q (%s), want %q", stat.Path, stat.Status, stat.Reason, want)
+				}
+				if stat.Tokens != tokens(stat.Path) {
+					t.Errorf("%s: %d tokens, want %d", stat.Path, stat.Tokens, tokens(stat.Path))
+				}
+				if stat.Status == StatusCollected {
+					total += stat.Tokens
+				}
+			}
+			if !reflect.DeepEqual(paths, walkOrder) {
+				t.Errorf("files %q, want them in walk order %q", paths, walkOrder)
+			}
+			if result.TotalTokens != total {
+				t.Errorf("TotalTokens %d, want the sum of the collected files, %d", result.TotalTokens, total)
+			}
+			wantFiles, wantTotal := len(walkOrder), all
+			if test.skipped != "" {
+				wantFiles, wantTotal = wantFiles-1, all-tokens(test.skipped)
+			}
+			if result.TotalFiles != wantFiles || total != wantTotal {
+				t.Errorf("collected %d files of %d tokens, want %d of %d", result.TotalFiles, total, wantFiles, wantTotal)
+			}
+
+			// The document follows the walk order too.
+			last := -1
+			for _, p := range walkOrder {
+				at := strings.Index(result.Output, "File: "+p+"\n")
+				if p == test.skipped {
+					if at >= 0 {
+						t.Errorf("output contains the skipped %s", p)
+					}
+					continue
+				}
+				if at <= last {
+					t.Errorf("output has %s at %d, after the previous file at %d", p, at, last)
+				}
+				last = at
+			}
+
+			var filtered []string
+			for _, stat := range result.Filtered {
+				filtered = append(filtered, stat.Path)
+			}
+			if want := []string{"node_modules", "package-lock.json"}; !reflect.DeepEqual(filtered, want) {
+				t.Errorf("filtered %q, want %q", filtered, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package collect
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings accepted in Collector.Encoding.
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin1"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// detectEncoding guesses the encoding of a file from its first bytes: a byte
+// order mark if there is one, then the NUL bytes UTF-16 puts in every other
+// byte of ASCII text, then whether the bytes are valid UTF-8. Anything else
+// is taken as Latin-1, which every byte sequence is.
+func detectEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(head, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(head, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	if units := len(head) / 2; units >= 4 {
+		evenNUL, oddNUL := 0, 0
+		for i := 0; i+1 < len(head); i += 2 {
+			if head[i] == 0 {
+				evenNUL++
+			}
+			if head[i+1] == 0 {
+				oddNUL++
+			}
+		}
+		switch {
+		case oddNUL*10 >= units*4 && evenNUL*20 < units:
+			return EncodingUTF16LE
+		case evenNUL*10 >= units*4 && oddNUL*20 < units:
+			return EncodingUTF16BE
+		}
+	}
+	// The head may end in the middle of a character.
+	for cut := 0; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) {
+			return EncodingUTF8
+		}
+	}
+	if len(head) == 0 {
+		return EncodingUTF8
+	}
+	return EncodingLatin1
+}
+
+// decodeText converts data in the given encoding to UTF-8, dropping its byte
+// order mark.
+func decodeText(data []byte, encoding string) string {
+	switch encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		if bytes.HasPrefix(data, bomUTF16LE) || bytes.HasPrefix(data, bomUTF16BE) {
+			data = data[2:]
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if encoding == EncodingUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units))
+	case EncodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(bytes.TrimPrefix(data, bomUTF8))
+}
+
+// isUTF16 reports whether text in encoding holds NUL bytes by nature, so
+// that they do not mark it as binary.
+func isUTF16(encoding string) bool {
+	return encoding == EncodingUTF16LE || encoding == EncodingUTF16BE
+}
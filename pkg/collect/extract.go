@@ -0,0 +1,408 @@
+package collect
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Document formats whose text Collect can extract, accepted in
+// Collector.Extract.
+const (
+	ExtractPDF      = "pdf"
+	ExtractDOCX     = "docx"
+	ExtractHTML     = "html"
+	ExtractNotebook = "ipynb"
+)
+
+// Extractors lists the formats accepted in Collector.Extract.
+var Extractors = []string{ExtractPDF, ExtractDOCX, ExtractHTML, ExtractNotebook}
+
+// DefaultExtractTokens is the ExtractTokens of a Collector returned by New.
+const DefaultExtractTokens = 10000
+
+// extractor turns the content of the files with the given extensions into
+// text, returning the language it is in: plain text, Markdown where the
+// document has structure worth keeping, or source code.
+type extractor struct {
+	extensions []string
+	extract    func(c *Collector, data []byte) (string, string, error)
+}
+
+var extractors = map[string]extractor{
+	ExtractPDF:      {[]string{".pdf"}, inLanguage("Text", extractPDF)},
+	ExtractDOCX:     {[]string{".docx"}, inLanguage("Markdown", extractDOCX)},
+	ExtractHTML:     {[]string{".html", ".htm", ".xhtml"}, inLanguage("Markdown", extractHTML)},
+	ExtractNotebook: {[]string{".ipynb"}, (*Collector).extractNotebook},
+}
+
+// inLanguage adapts an extraction whose text is always in language.
+func inLanguage(language string, extract func([]byte) (string, error)) func(*Collector, []byte) (string, string, error) {
+	return func(_ *Collector, data []byte) (string, string, error) {
+		text, err := extract(data)
+		return text, language, err
+	}
+}
+
+// extractorFor returns the extractor Extract enables for the file at p,
+// unless BinaryExtensions says to skip it.
+func (c *Collector) extractorFor(p string) (extractor, bool) {
+	if hasExtension(p, c.BinaryExtensions) {
+		return extractor{}, false
+	}
+	for _, name := range c.Extract {
+		if e, ok := extractors[name]; ok && hasExtension(p, e.extensions) {
+			return e, true
+		}
+	}
+	return extractor{}, false
+}
+
+// extractDOCX returns the text of a Word document as Markdown: its
+// paragraphs, with headings and list items marked as such, and its tables
+// with the cells of a row separated by bars.
+func extractDOCX(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	file, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", errors.New("not a Word document")
+	}
+	defer file.Close()
+
+	var b strings.Builder
+	var paragraph strings.Builder
+	prefix := ""
+	inText := false
+	cells := 0 // the cells of the table row being read
+	inCell := 0
+	decoder := xml.NewDecoder(file)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "p":
+				paragraph.Reset()
+				prefix = ""
+			case "pStyle":
+				if style := xmlAttr(tok, "val"); strings.HasPrefix(style, "Heading") {
+					if level, err := strconv.Atoi(strings.TrimPrefix(style, "Heading")); err == nil && level >= 1 && level <= 6 {
+						prefix = strings.Repeat("#", level) + " "
+					}
+				} else if style == "Title" {
+					prefix = "# "
+				}
+			case "numPr":
+				if prefix == "" {
+					prefix = "- "
+				}
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteByte('\t')
+			case "br", "cr":
+				paragraph.WriteByte('\n')
+			case "tc":
+				inCell++
+			case "tr":
+				cells = 0
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(tok)
+			}
+		case xml.EndElement:
+			switch tok.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				paragraph.Reset()
+				if inCell > 0 {
+					if text != "" {
+						if cells > 0 {
+							b.WriteString(" | ")
+						}
+						b.WriteString(text)
+						cells++
+					}
+					continue
+				}
+				if text != "" {
+					b.WriteString(prefix + text + "\n\n")
+				}
+			case "tc":
+				inCell--
+			case "tr":
+				if cells > 0 {
+					b.WriteString("\n")
+				}
+			case "tbl":
+				b.WriteString("\n")
+			}
+		}
+	}
+	return tidyText(b.String()), nil
+}
+
+// xmlAttr returns the value of the attribute of el called name, in any
+// namespace.
+func xmlAttr(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// htmlSkipped are the elements whose content is not text to read.
+var htmlSkipped = map[string]bool{"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true}
+
+// htmlBlocks are the elements that start a new paragraph.
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true, "main": true, "nav": true, "aside": true,
+	"blockquote": true, "figure": true, "figcaption": true, "form": true, "table": true, "dl": true, "dt": true, "dd": true,
+}
+
+// extractHTML converts an HTML page to Markdown: headings, paragraphs, lists,
+// links, emphasis, code and preformatted blocks keep their meaning, and the
+// scripts, styles and markup go. It reads HTML as browsers do, without
+// requiring it to be well formed.
+func extractHTML(data []byte) (string, error) {
+	src := string(data)
+	var b markdown
+	var lists []int // per open list, the number of the next item; 0 for bullets
+	var links []string
+	pre := 0
+	space := func() {
+		if c := b.last(); c != ' ' && c != '\n' {
+			b.writeByte(' ')
+		}
+	}
+	breakLine := func(blank bool) {
+		for b.last() == ' ' {
+			b.buf = b.buf[:len(b.buf)-1]
+		}
+		if len(b.buf) == 0 {
+			return
+		}
+		if b.last() != '\n' {
+			b.writeByte('\n')
+		}
+		if blank && !bytes.HasSuffix(b.buf, []byte("\n\n")) {
+			b.writeByte('\n')
+		}
+	}
+	text := func(s string) {
+		s = html.UnescapeString(s)
+		if pre > 0 {
+			b.write(s)
+			return
+		}
+		if strings.TrimSpace(s) == "" {
+			if s != "" {
+				space()
+			}
+			return
+		}
+		if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+			space()
+		}
+		b.write(strings.Join(strings.Fields(s), " "))
+		if last := s[len(s)-1]; last == ' ' || last == '\t' || last == '\n' || last == '\r' {
+			b.writeByte(' ')
+		}
+	}
+
+	for i := 0; i < len(src); {
+		lt := strings.IndexByte(src[i:], '<')
+		if lt < 0 {
+			text(src[i:])
+			break
+		}
+		text(src[i : i+lt])
+		i += lt
+		if strings.HasPrefix(src[i:], "<!--") {
+			end := strings.Index(src[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + len("-->")
+			continue
+		}
+		gt := strings.IndexByte(src[i:], '>')
+		if gt < 0 {
+			break
+		}
+		tag := src[i+1 : i+gt]
+		i += gt + 1
+		if tag == "" || tag[0] == '!' || tag[0] == '?' {
+			continue
+		}
+		closing := tag[0] == '/'
+		name, attrs := strings.TrimPrefix(tag, "/"), ""
+		if end := strings.IndexAny(name, " \t\r\n/"); end >= 0 {
+			name, attrs = name[:end], name[end:]
+		}
+		name = strings.ToLower(name)
+		if !closing && htmlSkipped[name] && !strings.HasSuffix(tag, "/") {
+			// The content is left out up to the element's end tag.
+			end := strings.Index(strings.ToLower(src[i:]), "</"+name)
+			if end < 0 {
+				break
+			}
+			i += end
+			continue
+		}
+		switch name {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			breakLine(true)
+			if !closing {
+				b.write(strings.Repeat("#", int(name[1]-'0')) + " ")
+			}
+		case "br":
+			breakLine(false)
+		case "hr":
+			breakLine(true)
+			b.write("---\n\n")
+		case "ul", "ol":
+			if closing {
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			} else if name == "ol" {
+				lists = append(lists, 1)
+			} else {
+				lists = append(lists, 0)
+			}
+			breakLine(len(lists) == 0)
+		case "li":
+			breakLine(false)
+			if !closing {
+				marker := "- "
+				if n := len(lists); n > 0 && lists[n-1] > 0 {
+					marker = strconv.Itoa(lists[n-1]) + ". "
+					lists[n-1]++
+				}
+				b.write(strings.Repeat("  ", max(len(lists)-1, 0)) + marker)
+			}
+		case "tr":
+			breakLine(false)
+		case "td", "th":
+			if c := b.last(); !closing && c != '\n' {
+				b.write(" | ")
+			}
+		case "pre":
+			breakLine(!closing)
+			if closing {
+				pre = max(pre-1, 0)
+				b.write("```\n\n")
+			} else {
+				pre++
+				b.write("```\n")
+			}
+		case "code", "kbd", "samp":
+			if pre == 0 {
+				b.writeByte('`')
+			}
+		case "strong", "b":
+			b.write("**")
+		case "em", "i":
+			b.writeByte('*')
+		case "a":
+			if closing {
+				if n := len(links); n > 0 {
+					if href := links[n-1]; href != "" {
+						b.write("](" + href + ")")
+					}
+					links = links[:n-1]
+				}
+				break
+			}
+			href := htmlAttr(attrs, "href")
+			if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+				href = ""
+			} else {
+				b.writeByte('[')
+			}
+			links = append(links, href)
+		case "img":
+			if alt := htmlAttr(attrs, "alt"); alt != "" {
+				b.write("![" + alt + "](" + htmlAttr(attrs, "src") + ")")
+			}
+		default:
+			if htmlBlocks[name] {
+				breakLine(true)
+			}
+		}
+	}
+	return tidyText(string(b.buf)), nil
+}
+
+// markdown is the text extractHTML writes, which it looks back on to space
+// it out.
+type markdown struct {
+	buf []byte
+}
+
+func (m *markdown) write(s string)   { m.buf = append(m.buf, s...) }
+func (m *markdown) writeByte(c byte) { m.buf = append(m.buf, c) }
+
+// last returns the last byte written, or a newline at the start.
+func (m *markdown) last() byte {
+	if len(m.buf) == 0 {
+		return '\n'
+	}
+	return m.buf[len(m.buf)-1]
+}
+
+// htmlAttr returns the value of the attribute called name among the
+// attributes of a tag, unescaped.
+func htmlAttr(attrs, name string) string {
+	lower := strings.ToLower(attrs)
+	for i := 0; i < len(lower); {
+		at := strings.Index(lower[i:], name)
+		if at < 0 {
+			return ""
+		}
+		at += i
+		i = at + len(name)
+		if at > 0 && lower[at-1] != ' ' && lower[at-1] != '\t' && lower[at-1] != '\n' {
+			continue
+		}
+		rest := strings.TrimLeft(attrs[i:], " \t\n")
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\n")
+		if rest == "" {
+			return ""
+		}
+		if quote := rest[0]; quote == '"' || quote == '\'' {
+			if end := strings.IndexByte(rest[1:], quote); end >= 0 {
+				return html.UnescapeString(rest[1 : end+1])
+			}
+			return html.UnescapeString(rest[1:])
+		}
+		if end := strings.IndexAny(rest, " \t\n>"); end >= 0 {
+			rest = rest[:end]
+		}
+		return html.UnescapeString(strings.TrimSuffix(rest, "/"))
+	}
+	return ""
+}
@@ -0,0 +1,248 @@
+package collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Output formats accepted in Collector.Format.
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatXML      = "xml"
+	FormatJSON     = "json"
+	FormatHTML     = "html"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{FormatText, FormatMarkdown, FormatXML, FormatJSON, FormatHTML}
+
+func isValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// fenceLanguages maps language names to the info strings markdown renderers
+// expect after the opening code fence, where they differ from the lowercased
+// name.
+var fenceLanguages = map[string]string{
+	"C++":              "cpp",
+	"C#":               "csharp",
+	"F#":               "fsharp",
+	"Objective-C":      "objectivec",
+	"Shell":            "bash",
+	"Protocol Buffers": "protobuf",
+	"reStructuredText": "rst",
+}
+
+func fenceLanguage(language string) string {
+	if tag, ok := fenceLanguages[language]; ok {
+		return tag
+	}
+	return strings.ToLower(language)
+}
+
+// codeFence returns a backtick fence longer than any run of backticks in
+// content, so the content cannot close the block early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// formatter renders files and the document around them in one format.
+type formatter struct {
+	format    string
+	header    string
+	separator string
+	sections  []Section
+	// tree is false when the document leaves out the file tree.
+	tree bool
+	// aliases are the placeholder names of AnonymizePaths, or nil.
+	aliases map[string]string
+}
+
+// Section is extra material placed after the file contents, such as a diff.
+type Section struct {
+	Name     string
+	Language string // used for the markdown code fence
+	Content  string
+}
+
+// file renders a single file's content.
+func (f formatter) file(relativePath, language, content string) string {
+	switch f.format {
+	case FormatMarkdown:
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		fence := codeFence(content)
+		return fmt.Sprintf("## %s\n\n%s%s\n%s%s\n\n", relativePath, fence, fenceLanguage(language), content, fence)
+	case FormatXML:
+		// Contents are left unescaped, as in Anthropic's long-context prompt
+		// examples; escaping code would cost tokens and readability.
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return fmt.Sprintf("<document>\n<source>%s</source>\n<document_contents>\n%s</document_contents>\n</document>\n", relativePath, content)
+	case FormatJSON, FormatHTML:
+		// The JSON and HTML documents are assembled from the file stats; the
+		// content is returned as-is so its tokens are counted without any
+		// decoration.
+		return content
+	default:
+		// Like the other formats, a missing final newline is supplied so
+		// that the separator starts on a line of its own.
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return fmt.Sprintf(f.header, relativePath) + content + f.separator
+	}
+}
+
+// document combines the file tree and the formatted files.
+func (f formatter) document(result Result, contents string) (string, error) {
+	switch f.format {
+	case FormatJSON:
+		return encodeJSONDocument(f.jsonDocument(result))
+	case FormatHTML:
+		return f.htmlDocument(result), nil
+	}
+	before, after := f.frame(result)
+	return before + contents + after, nil
+}
+
+// frame returns what a document places before and after the formatted
+// files, for every format but JSON.
+func (f formatter) frame(result Result) (string, string) {
+	switch f.format {
+	case FormatMarkdown:
+		return f.treeSection("# File Tree\n\n```\n%s```\n\n", result.FileTree) + "# Contents\n\n", f.renderSections()
+	case FormatXML:
+		return f.treeSection("<file_tree>\n%s</file_tree>\n", result.FileTree) + "<documents>\n", "</documents>\n" + f.renderSections()
+	default:
+		return f.treeSection("File Tree:\n%s\n\n", result.FileTree) + "Contents:\n", f.renderSections()
+	}
+}
+
+// treeSection renders the file tree in layout, or nothing if the document
+// leaves it out.
+func (f formatter) treeSection(layout, tree string) string {
+	if !f.tree {
+		return ""
+	}
+	return fmt.Sprintf(layout, tree)
+}
+
+// renderSections renders the sections that follow the contents. In JSON
+// they are a field of the document instead, and HTML pages lay them out
+// themselves.
+func (f formatter) renderSections() string {
+	var b strings.Builder
+	for _, section := range f.sections {
+		content := section.Content
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		switch f.format {
+		case FormatMarkdown:
+			fence := codeFence(content)
+			fmt.Fprintf(&b, "# %s\n\n%s%s\n%s%s\n\n", section.Name, fence, section.Language, content, fence)
+		case FormatXML:
+			tag := strings.ToLower(strings.ReplaceAll(section.Name, " ", "_"))
+			fmt.Fprintf(&b, "<%s>\n%s</%s>\n", tag, content, tag)
+		case FormatJSON, FormatHTML:
+			b.WriteString(section.Content)
+		default:
+			fmt.Fprintf(&b, "\n%s:\n%s", section.Name, content)
+		}
+	}
+	return b.String()
+}
+
+// partHeader introduces one part of a split collection. JSON documents
+// carry the part numbers as fields instead, and HTML pages go without.
+func (f formatter) partHeader(part, parts int) string {
+	switch f.format {
+	case FormatMarkdown:
+		return fmt.Sprintf("# Part %d of %d\n\n", part, parts)
+	case FormatXML:
+		return fmt.Sprintf("<part>%d of %d</part>\n", part, parts)
+	case FormatJSON, FormatHTML:
+		return ""
+	default:
+		return fmt.Sprintf("Part %d of %d\n\n", part, parts)
+	}
+}
+
+// jsonDocument is the FormatJSON output: the manifest of collected files
+// with their contents, plus the candidates that were skipped. Since it is a
+// superset of the manifest, it can be used as a comparison baseline.
+type jsonDocument struct {
+	Manifest
+	Skipped  []jsonSkippedFile `json:"skipped"`
+	Sections []jsonSection     `json:"sections,omitempty"`
+	// Part and Parts number the documents of a split collection.
+	Part  int `json:"part,omitempty"`
+	Parts int `json:"parts,omitempty"`
+}
+
+type jsonSection struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+type jsonSkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (f formatter) jsonDocument(result Result) jsonDocument {
+	doc := jsonDocument{Manifest: result.Manifest(), Skipped: []jsonSkippedFile{}}
+	for _, section := range f.sections {
+		doc.Sections = append(doc.Sections, jsonSection{Name: section.Name, Content: section.Content})
+	}
+	contents := make(map[string]string)
+	for _, stat := range result.Files {
+		if stat.Status == StatusCollected {
+			contents[stat.Path] = stat.Content
+		} else {
+			doc.Skipped = append(doc.Skipped, jsonSkippedFile{Path: stat.Path, Reason: stat.Reason})
+		}
+	}
+	for i := range doc.Files {
+		doc.Files[i].Content = contents[doc.Files[i].Path]
+		doc.Files[i].Path = f.name(doc.Files[i].Path)
+	}
+	for i := range doc.Skipped {
+		doc.Skipped[i].Path = f.name(doc.Skipped[i].Path)
+	}
+	if f.aliases != nil {
+		doc.Root = "."
+	}
+	sort.Slice(doc.Skipped, func(i, j int) bool { return doc.Skipped[i].Path < doc.Skipped[j].Path })
+	return doc
+}
+
+func encodeJSONDocument(doc jsonDocument) (string, error) {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
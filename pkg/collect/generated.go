@@ -0,0 +1,30 @@
+package collect
+
+import (
+	"regexp"
+	"strings"
+)
+
+// generatedHeaderLines is how far into a file generatedMarker is looked for.
+// Generators put their notice first, while a mention further down is more
+// likely ordinary code.
+const generatedHeaderLines = 10
+
+// generatedLine returns the number of the line marking text as generated,
+// or 0 if its first lines hold no marker.
+func generatedLine(text string) int {
+	for i, line := range strings.SplitN(text, "\n", generatedHeaderLines+1) {
+		if i == generatedHeaderLines {
+			break
+		}
+		if generatedMarker.MatchString(line) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// generatedMarker matches the comments code generators put at the top of
+// their output: Go's "Code generated ... DO NOT EDIT.", the "@generated"
+// tag of Meta's tools, and the "auto-generated" notices of many others.
+var generatedMarker = regexp.MustCompile(`(?i:\bcode generated\b|\bauto-?generated\b|\bautomatically generated\b)|\bDO NOT EDIT\b|@generated\b`)
@@ -0,0 +1,223 @@
+package collect
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The .gitattributes attributes GitHub's linguist uses to hide files from
+// diffs and language statistics, and which collect skips.
+const (
+	attrGenerated = "linguist-generated"
+	attrVendored  = "linguist-vendored"
+)
+
+// gitattributesRule is a pattern line from a .gitattributes file, reduced to
+// the linguist attributes it sets (true) or unsets (false).
+type gitattributesRule struct {
+	source   string
+	base     string
+	segments []string
+	attrs    map[string]bool
+}
+
+// Gitattributes evaluates the linguist-generated and linguist-vendored
+// attributes of .gitattributes files. Patterns match like .gitignore
+// patterns, without negation, and as in git the last line setting an
+// attribute wins, with deeper files overriding shallower ones.
+type Gitattributes struct {
+	rules []gitattributesRule
+	// prefix is the collection root relative to the top of the work tree.
+	prefix string
+	loaded map[string]bool
+}
+
+// LoadGitattributes collects the attributes that apply to rootDir, a
+// directory on disk, before the walk starts: the global attributes file and
+// .git/info/attributes, and the .gitattributes files of the directories
+// above rootDir. The .gitattributes files inside rootDir are added during
+// the walk. Outside a git work tree only those apply.
+func LoadGitattributes(rootDir string) (*Gitattributes, error) {
+	g := &Gitattributes{}
+	top, ok := findWorkTree(rootDir)
+	if !ok {
+		return g, nil
+	}
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(top, absRoot)
+	if err != nil {
+		return nil, err
+	}
+	g.prefix = filepath.ToSlash(prefix)
+	if g.prefix == "." {
+		g.prefix = ""
+	}
+
+	if attributesFile := globalAttributesFile(); attributesFile != "" {
+		if err := g.addFile("", attributesFile); err != nil {
+			return nil, err
+		}
+	}
+	if g.prefix != "" {
+		dir := ""
+		for _, segment := range strings.Split(g.prefix, "/") {
+			if err := g.addFile(dir, filepath.Join(top, filepath.FromSlash(dir), ".gitattributes")); err != nil {
+				return nil, err
+			}
+			dir = path.Join(dir, segment)
+		}
+	}
+	// git gives .git/info/attributes precedence over the .gitattributes
+	// above rootDir; the ones found during the walk still come after it.
+	if err := g.addFile("", filepath.Join(top, ".git", "info", "attributes")); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// globalAttributesFile returns the path of git's core.attributesFile,
+// falling back to git's default location when it is not configured.
+func globalAttributesFile() string {
+	if out, err := exec.Command("git", "config", "--path", "core.attributesFile").Output(); err == nil {
+		if file := strings.TrimSpace(string(out)); file != "" {
+			return file
+		}
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "attributes")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "attributes")
+	}
+	return ""
+}
+
+// clone returns a copy that can be extended without affecting g.
+func (g *Gitattributes) clone() *Gitattributes {
+	if g == nil {
+		return nil
+	}
+	c := &Gitattributes{rules: append([]gitattributesRule{}, g.rules...), prefix: g.prefix, loaded: make(map[string]bool)}
+	for base := range g.loaded {
+		c.loaded[base] = true
+	}
+	return c
+}
+
+// loadDir adds the rules of the .gitattributes in dir, a directory of fsys.
+// Each directory is only read once.
+func (g *Gitattributes) loadDir(fsys fs.FS, dir string) error {
+	if g == nil {
+		return nil
+	}
+	base := path.Join(g.prefix, dir)
+	if g.loaded == nil {
+		g.loaded = make(map[string]bool)
+	}
+	if g.loaded[base] {
+		return nil
+	}
+	g.loaded[base] = true
+	data, err := fs.ReadFile(fsys, path.Join(dir, ".gitattributes"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			return nil
+		}
+		return err
+	}
+	g.addLines(base, strings.Split(string(data), "\n"))
+	return nil
+}
+
+// addFile adds the rules of a file if it exists; file is relative to base.
+func (g *Gitattributes) addFile(base, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil
+		}
+		return err
+	}
+	g.addLines(base, strings.Split(string(data), "\n"))
+	return nil
+}
+
+// addLines adds the lines of a .gitattributes located in base, a directory
+// relative to the top of the work tree. Lines that set neither linguist
+// attribute are dropped.
+func (g *Gitattributes) addLines(base string, lines []string) {
+	if base == "." {
+		base = ""
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+		rule := gitattributesRule{source: strings.TrimSpace(line), base: base, attrs: map[string]bool{}}
+		for _, attr := range fields[1:] {
+			name, value, hasValue := strings.Cut(attr, "=")
+			set := true
+			switch {
+			case strings.HasPrefix(name, "-") || strings.HasPrefix(name, "!"):
+				name, set = name[1:], false
+			case hasValue:
+				set = value == "true" || value == "1"
+			}
+			if name == attrGenerated || name == attrVendored {
+				rule.attrs[name] = set
+			}
+		}
+		if len(rule.attrs) == 0 {
+			continue
+		}
+		pattern := fields[0]
+		anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+		rule.segments = strings.Split(strings.Trim(pattern, "/"), "/")
+		if !anchored {
+			rule.segments = append([]string{"**"}, rule.segments...)
+		}
+		g.rules = append(g.rules, rule)
+	}
+}
+
+// match returns the first of attrs set on the file at relativePath, relative
+// to the collection root, along with the line that set it, or an empty
+// string if none is.
+func (g *Gitattributes) match(relativePath string, attrs []string) (string, string) {
+	if g == nil || len(g.rules) == 0 {
+		return "", ""
+	}
+	full := path.Join(g.prefix, relativePath)
+	state := map[string]bool{}
+	source := map[string]string{}
+	for _, rule := range g.rules {
+		subject := full
+		if rule.base != "" {
+			if !strings.HasPrefix(subject, rule.base+"/") {
+				continue
+			}
+			subject = subject[len(rule.base)+1:]
+		}
+		if !matchSegments(rule.segments, strings.Split(subject, "/")) {
+			continue
+		}
+		for name, set := range rule.attrs {
+			state[name], source[name] = set, rule.source
+		}
+	}
+	for _, name := range attrs {
+		if state[name] {
+			return name, source[name]
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,286 @@
+package collect
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreRule is a single pattern line from a .gitignore file.
+type gitignoreRule struct {
+	source   string // the line as written, for reporting
+	base     string // slash-separated directory the rule is relative to, "" for the root
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Gitignore evaluates .gitignore rules with git's semantics: the last
+// matching rule wins, "!" re-includes, a trailing "/" only matches
+// directories, a "/" elsewhere anchors the pattern to the .gitignore's
+// directory, "**" spans any number of directories, and nothing inside an
+// ignored directory can be re-included.
+//
+// Rules are layered like git's: the global excludes file first, then
+// .git/info/exclude, then .gitignore files from the repository root down, so
+// that deeper files override shallower ones.
+type Gitignore struct {
+	rules []gitignoreRule
+	// prefix is the collection root relative to the top of the work tree,
+	// since rules are anchored there rather than at the collection root.
+	prefix string
+	loaded map[string]bool
+	// names lists the files read in each directory of the walk, later ones
+	// taking precedence; just .gitignore if empty.
+	names []string
+}
+
+// LoadGitignores collects the excludes that apply to rootDir, a directory on
+// disk, before the walk starts: the global excludes file and
+// .git/info/exclude when rootDir is in a git work tree, and the .gitignore
+// files of the directories above rootDir. The .gitignore files inside rootDir
+// are added during the walk.
+func LoadGitignores(rootDir string) (*Gitignore, error) {
+	g := &Gitignore{}
+	top, ok := findWorkTree(rootDir)
+	if !ok {
+		return g, nil
+	}
+	absRoot, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := filepath.Rel(top, absRoot)
+	if err != nil {
+		return nil, err
+	}
+	g.prefix = filepath.ToSlash(prefix)
+	if g.prefix == "." {
+		g.prefix = ""
+	}
+
+	if excludesFile := globalExcludesFile(); excludesFile != "" {
+		if err := g.addFile("", excludesFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.addFile("", filepath.Join(top, ".git", "info", "exclude")); err != nil {
+		return nil, err
+	}
+	if g.prefix != "" {
+		dir := ""
+		for _, segment := range strings.Split(g.prefix, "/") {
+			if err := g.addFile(dir, filepath.Join(top, filepath.FromSlash(dir), ".gitignore")); err != nil {
+				return nil, err
+			}
+			dir = path.Join(dir, segment)
+		}
+	}
+	return g, nil
+}
+
+// clone returns a copy that can be extended without affecting g.
+func (g *Gitignore) clone() *Gitignore {
+	if g == nil {
+		return nil
+	}
+	c := &Gitignore{rules: append([]gitignoreRule{}, g.rules...), prefix: g.prefix, loaded: make(map[string]bool), names: g.names}
+	for base := range g.loaded {
+		c.loaded[base] = true
+	}
+	return c
+}
+
+// loadDir adds the rules of the .gitignore in dir, a directory of fsys, or
+// of the files in g.names. Each directory is only read once.
+func (g *Gitignore) loadDir(fsys fs.FS, dir string) error {
+	if g == nil {
+		return nil
+	}
+	base := path.Join(g.prefix, dir)
+	if g.loaded == nil {
+		g.loaded = make(map[string]bool)
+	}
+	if g.loaded[base] {
+		return nil
+	}
+	g.loaded[base] = true
+	names := g.names
+	if len(names) == 0 {
+		names = []string{".gitignore"}
+	}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				continue
+			}
+			return err
+		}
+		g.addPatterns(base, strings.Split(string(data), "\n"))
+	}
+	return nil
+}
+
+// addFile adds the rules of a file if it exists; file is relative to base.
+func (g *Gitignore) addFile(base, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return nil
+		}
+		return err
+	}
+	g.addPatterns(base, strings.Split(string(data), "\n"))
+	return nil
+}
+
+// findWorkTree returns the top directory of the git work tree containing dir.
+func findWorkTree(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// globalExcludesFile returns the path of git's core.excludesFile, falling
+// back to git's default location when it is not configured.
+func globalExcludesFile() string {
+	if out, err := exec.Command("git", "config", "--path", "core.excludesFile").Output(); err == nil {
+		if file := strings.TrimSpace(string(out)); file != "" {
+			return file
+		}
+	}
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// addPatterns adds the lines of a .gitignore located in base, a directory
+// relative to the top of the work tree ("" or "." for the top itself).
+func (g *Gitignore) addPatterns(base string, lines []string) {
+	base = filepath.ToSlash(base)
+	if base == "." {
+		base = ""
+	}
+	for _, line := range lines {
+		if rule, ok := parseGitignoreRule(base, line); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+}
+
+func parseGitignoreRule(base, line string) (gitignoreRule, bool) {
+	rule := gitignoreRule{source: line, base: base}
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false
+	}
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return rule, false
+	}
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	return rule, true
+}
+
+// match reports whether the path, relative to the collection root, is
+// ignored, along with the rule that decided it.
+func (g *Gitignore) match(relativePath string, isDir bool) (bool, string) {
+	if g == nil || len(g.rules) == 0 {
+		return false, ""
+	}
+	segments := strings.Split(path.Join(g.prefix, relativePath), "/")
+	// A file cannot be re-included if one of its parent directories is ignored.
+	for i := 1; i < len(segments); i++ {
+		if ignored, rule := g.decide(segments[:i], true); ignored {
+			return true, rule
+		}
+	}
+	return g.decide(segments, isDir)
+}
+
+func (g *Gitignore) decide(segments []string, isDir bool) (bool, string) {
+	ignored, source := false, ""
+	relativePath := strings.Join(segments, "/")
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		subject := relativePath
+		if rule.base != "" {
+			if !strings.HasPrefix(subject, rule.base+"/") {
+				continue
+			}
+			subject = subject[len(rule.base)+1:]
+		}
+		if matchSegments(rule.segments, strings.Split(subject, "/")) {
+			ignored, source = !rule.negate, rule.source
+		}
+	}
+	return ignored, source
+}
+
+// matchSegments matches a path against a pattern, both split on "/". A "**"
+// segment matches any number of path segments; a trailing "**" matches
+// everything inside a directory but not the directory itself.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(rest, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
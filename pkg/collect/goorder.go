@@ -0,0 +1,161 @@
+package collect
+
+import (
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goModule matches the module directive of a go.mod file.
+var goModule = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)"?`)
+
+// goImports maps the directory of each Go package among files to the
+// directories of the packages of the same module it imports, as found by
+// reading the import declarations and the nearest go.mod above each package.
+// Test files are left out: an external test package may import packages
+// that depend on the one it tests.
+func goImports(fsys fs.FS, files []string) map[string][]string {
+	modules := make(map[string][2]string) // per directory, its module's path and directory
+	var module func(dir string) (string, string)
+	module = func(dir string) (string, string) {
+		if m, ok := modules[dir]; ok {
+			return m[0], m[1]
+		}
+		var m [2]string
+		if data, err := fs.ReadFile(fsys, path.Join(dir, "go.mod")); err == nil {
+			if match := goModule.FindSubmatch(data); match != nil {
+				m = [2]string{string(match[1]), dir}
+			}
+		} else if dir != "." {
+			m[0], m[1] = module(path.Dir(dir))
+		}
+		modules[dir] = m
+		return m[0], m[1]
+	}
+
+	imports := make(map[string][]string)
+	seen := make(map[[2]string]bool)
+	fset := token.NewFileSet()
+	for _, p := range files {
+		if path.Ext(p) != ".go" || strings.HasSuffix(p, "_test.go") {
+			continue
+		}
+		dir := path.Dir(p)
+		if _, ok := imports[dir]; !ok {
+			imports[dir] = nil
+		}
+		modulePath, moduleDir := module(dir)
+		if modulePath == "" {
+			continue
+		}
+		src, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			continue
+		}
+		parsed, err := parser.ParseFile(fset, p, src, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range parsed.Imports {
+			imported, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || imported != modulePath && !strings.HasPrefix(imported, modulePath+"/") {
+				continue
+			}
+			target := path.Join(moduleDir, strings.TrimPrefix(imported, modulePath))
+			if target != dir && !seen[[2]string{dir, target}] {
+				seen[[2]string{dir, target}] = true
+				imports[dir] = append(imports[dir], target)
+			}
+		}
+	}
+	for dir := range imports {
+		sort.Strings(imports[dir])
+	}
+	return imports
+}
+
+// orderGoFiles reorders the Go files among files so that every package
+// comes before the packages importing it, keeping the walk order where the
+// imports leave a choice. The other files keep their places.
+func orderGoFiles(files []string, imports map[string][]string) []string {
+	// first is where each package's files first appear, to break ties.
+	first := make(map[string]int)
+	var slots []int
+	byDir := make(map[string][]string)
+	for i, p := range files {
+		if path.Ext(p) != ".go" {
+			continue
+		}
+		dir := path.Dir(p)
+		if _, ok := first[dir]; !ok {
+			first[dir] = len(first)
+		}
+		slots = append(slots, i)
+		byDir[dir] = append(byDir[dir], p)
+	}
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return first[dirs[i]] < first[dirs[j]] })
+
+	// A depth-first walk places each package after what it imports. Imports
+	// of packages that are not collected are passed over, and a cycle, which
+	// Go forbids, is broken where it is found.
+	var ordered []string
+	state := make(map[string]int) // 1 while visiting, 2 once placed
+	var visit func(dir string)
+	visit = func(dir string) {
+		if state[dir] != 0 {
+			return
+		}
+		state[dir] = 1
+		deps := append([]string(nil), imports[dir]...)
+		sort.SliceStable(deps, func(i, j int) bool { return first[deps[i]] < first[deps[j]] })
+		for _, dep := range deps {
+			if _, ok := byDir[dep]; ok {
+				visit(dep)
+			}
+		}
+		state[dir] = 2
+		ordered = append(ordered, byDir[dir]...)
+	}
+	for _, dir := range dirs {
+		visit(dir)
+	}
+
+	reordered := append([]string(nil), files...)
+	for i, slot := range slots {
+		reordered[slot] = ordered[i]
+	}
+	return reordered
+}
+
+// importGraph lists, one line per package, the packages of the same module
+// that it imports, in the order of files. Packages importing none are left
+// out.
+func (f formatter) importGraph(files []string, imports map[string][]string) string {
+	var b strings.Builder
+	listed := make(map[string]bool)
+	for _, p := range files {
+		dir := path.Dir(p)
+		if path.Ext(p) != ".go" || listed[dir] {
+			continue
+		}
+		listed[dir] = true
+		if len(imports[dir]) == 0 {
+			continue
+		}
+		deps := make([]string, len(imports[dir]))
+		for i, dep := range imports[dir] {
+			deps[i] = f.name(dep)
+		}
+		b.WriteString(f.name(dir) + " -> " + strings.Join(deps, ", ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,241 @@
+package collect
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"strings"
+)
+
+// htmlStyle lays out the FormatHTML page: the file tree in a sidebar next to
+// the files, and the colors of the highlighted code.
+const htmlStyle = `
+:root { --bg: #fff; --fg: #1f2328; --muted: #59636e; --line: #d1d9e0; --code: #f6f8fa; --badge: #ddf4ff;
+  --comment: #6e7781; --string: #0a3069; --keyword: #cf222e; --number: #0550ae; }
+@media (prefers-color-scheme: dark) {
+  :root { --bg: #0d1117; --fg: #e6edf3; --muted: #9198a1; --line: #3d444d; --code: #161b22; --badge: #1f3a5f;
+    --comment: #9198a1; --string: #a5d6ff; --keyword: #ff7b72; --number: #79c0ff; }
+}
+* { box-sizing: border-box; }
+body { margin: 0; font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: var(--fg); background: var(--bg); }
+nav { position: fixed; top: 0; bottom: 0; left: 0; width: 320px; overflow: auto; padding: 16px; border-right: 1px solid var(--line); }
+main { margin-left: 320px; padding: 16px 24px; }
+nav details > *:not(summary) { margin-left: 14px; }
+nav summary { cursor: pointer; white-space: nowrap; }
+nav a { display: block; color: inherit; text-decoration: none; white-space: nowrap; }
+nav a:hover { text-decoration: underline; }
+h1 { font-size: 20px; margin: 0 0 4px; }
+h2 { display: inline; font-size: 15px; margin: 0; }
+.summary { color: var(--muted); margin: 0 0 16px; }
+.badge { display: inline-block; margin-left: 6px; padding: 0 6px; border-radius: 10px; background: var(--badge); color: var(--fg); font-size: 12px; font-weight: normal; }
+.file { margin: 0 0 16px; border: 1px solid var(--line); border-radius: 6px; }
+.file > summary { padding: 8px 12px; cursor: pointer; border-bottom: 1px solid var(--line); }
+pre { margin: 0; padding: 12px; overflow: auto; background: var(--code); font: 12px/1.45 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; }
+.c { color: var(--comment); font-style: italic; }
+.s { color: var(--string); }
+.k { color: var(--keyword); }
+.n { color: var(--number); }
+`
+
+// htmlNode is a directory or file of the sidebar's tree; files have the
+// index of their section.
+type htmlNode struct {
+	name     string
+	tokens   int
+	file     int
+	children []*htmlNode
+}
+
+func (n *htmlNode) child(name string) *htmlNode {
+	for _, c := range n.children {
+		if c.name == name && c.file < 0 {
+			return c
+		}
+	}
+	c := &htmlNode{name: name, file: -1}
+	n.children = append(n.children, c)
+	return c
+}
+
+// writeTree writes the sidebar entries below n, directories as collapsible
+// details.
+func (n *htmlNode) writeTree(b *strings.Builder) {
+	for _, c := range n.children {
+		if c.file >= 0 {
+			fmt.Fprintf(b, "<a href=\"#file-%d\">%s<span class=\"badge\">%d</span></a>\n", c.file, html.EscapeString(c.name), c.tokens)
+			continue
+		}
+		fmt.Fprintf(b, "<details open><summary>%s/<span class=\"badge\">%d</span></summary>\n", html.EscapeString(c.name), c.tokens)
+		c.writeTree(b)
+		b.WriteString("</details>\n")
+	}
+}
+
+// htmlDocument renders the FormatHTML output: a standalone page with the
+// collected files, highlighted and with their token counts, a sidebar tree
+// linking to them, the sections, and the files that were skipped.
+func (f formatter) htmlDocument(result Result) string {
+	root := &htmlNode{file: -1}
+	var files, skipped strings.Builder
+	skippedCount := 0
+	for i, stat := range result.Files {
+		if stat.Status != StatusCollected {
+			skippedCount++
+			fmt.Fprintf(&skipped, "<li>%s: %s</li>\n", html.EscapeString(f.name(stat.Path)), html.EscapeString(stat.Reason))
+			continue
+		}
+		name := f.name(stat.Path)
+		node := root
+		for _, dir := range strings.Split(path.Dir(name), "/") {
+			node.tokens += stat.Tokens
+			if dir != "." {
+				node = node.child(dir)
+			}
+		}
+		node.tokens += stat.Tokens
+		node.children = append(node.children, &htmlNode{name: path.Base(name), tokens: stat.Tokens, file: i})
+		fmt.Fprintf(&files, "<details class=\"file\" id=\"file-%d\" open><summary><h2>%s<span class=\"badge\">%d tokens</span></h2></summary>\n<pre><code>%s</code></pre>\n</details>\n",
+			i, html.EscapeString(f.label(stat)), stat.Tokens, highlight(stat.Language, stat.Content))
+	}
+
+	title := "collect"
+	if base := path.Base(strings.ReplaceAll(result.Root, "\\", "/")); f.aliases == nil && base != "." && base != "/" {
+		title += ": " + base
+	}
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n", html.EscapeString(title), htmlStyle)
+	b.WriteString("<nav>\n")
+	root.writeTree(&b)
+	b.WriteString("</nav>\n<main>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p class=\"summary\">%d tokens across %d files</p>\n", html.EscapeString(title), result.TotalTokens, result.TotalFiles)
+	if f.tree && result.FileTree != "" {
+		fmt.Fprintf(&b, "<details class=\"file\"><summary><h2>File Tree</h2></summary>\n<pre>%s</pre>\n</details>\n", html.EscapeString(result.FileTree))
+	}
+	b.WriteString(files.String())
+	for _, section := range f.sections {
+		fmt.Fprintf(&b, "<details class=\"file\" open><summary><h2>%s</h2></summary>\n<pre><code>%s</code></pre>\n</details>\n",
+			html.EscapeString(section.Name), highlight(section.Language, section.Content))
+	}
+	if skippedCount > 0 {
+		fmt.Fprintf(&b, "<details class=\"file\"><summary><h2>Skipped<span class=\"badge\">%d files</span></h2></summary>\n<ul>\n%s</ul>\n</details>\n", skippedCount, skipped.String())
+	}
+	b.WriteString("</main>\n</body>\n</html>\n")
+	return b.String()
+}
+
+func keywords(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var (
+	cKeywords    = keywords("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while true false NULL nullptr bool class namespace template typename public private protected virtual override new delete this using try catch throw")
+	jsKeywords   = keywords("async await break case catch class const continue debugger default delete do else export extends false finally for from function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while yield interface type enum implements private public protected readonly as")
+	javaKeywords = keywords("abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long native new null package private protected public return short static super switch synchronized this throw throws true false try void volatile while var val fun object when is in override data sealed namespace using string bool async await")
+)
+
+// highlightKeywords are the keywords highlight marks, by language. The
+// comments and strings of a language come from commentSyntaxes.
+var highlightKeywords = map[string]map[string]bool{
+	"Go":               keywords("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+	"JavaScript":       jsKeywords,
+	"TypeScript":       jsKeywords,
+	"Java":             javaKeywords,
+	"Kotlin":           javaKeywords,
+	"Scala":            javaKeywords,
+	"C#":               javaKeywords,
+	"Dart":             javaKeywords,
+	"C":                cKeywords,
+	"C++":              cKeywords,
+	"Objective-C":      cKeywords,
+	"Swift":            keywords("class struct enum protocol extension func var let if else guard switch case default for in while repeat return break continue import init self super nil true false throws throw try catch do public private internal static override"),
+	"Rust":             keywords("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while Some None Ok Err"),
+	"Protocol Buffers": keywords("syntax package import option message enum service rpc returns repeated optional required map oneof reserved"),
+	"PHP":              keywords("abstract array as break case catch class const continue default do echo else elseif extends false final for foreach function if implements interface namespace new null private protected public return static switch this throw true try use var while"),
+	"Python":           keywords("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield self"),
+	"Ruby":             keywords("alias and begin break case class def do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require"),
+	"Perl":             keywords("my our local sub if elsif else unless while until for foreach return last next use package require"),
+	"Shell":            keywords("if then else elif fi case esac for while until do done in function return local export readonly set unset shift exit"),
+	"PowerShell":       keywords("function param if elseif else switch foreach for while do until return break continue try catch finally throw"),
+	"Elixir":           keywords("def defp defmodule do end if else case cond fn when import alias use require true false nil"),
+	"Dockerfile":       keywords("FROM RUN CMD LABEL EXPOSE ENV ADD COPY ENTRYPOINT VOLUME USER WORKDIR ARG ONBUILD STOPSIGNAL HEALTHCHECK SHELL AS"),
+	"HCL":              keywords("resource data variable output module provider locals terraform true false null"),
+	"SQL":              keywords("SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE ALTER DROP INDEX VIEW JOIN LEFT RIGHT INNER OUTER ON AS AND OR NOT NULL IS IN GROUP BY ORDER HAVING LIMIT OFFSET PRIMARY KEY FOREIGN REFERENCES UNIQUE DEFAULT CASE WHEN THEN ELSE END DISTINCT UNION select from where insert into values update set delete create table alter drop index view join left right inner outer on as and or not null is in group by order having limit offset primary key foreign references unique default case when then else end distinct union"),
+	"Lua":              keywords("and break do else elseif end false for function if in local nil not or repeat return then true until while"),
+	"Haskell":          keywords("case class data deriving do else if import in infix instance let module newtype of then type where"),
+	"Clojure":          keywords("def defn defmacro fn let if do when cond loop recur ns require"),
+}
+
+// highlight escapes text for HTML, marking the comments, strings, numbers
+// and keywords of language with the classes htmlStyle colors. Like
+// stripComments it is lexical, so unusual code may be colored wrongly, but
+// the text itself is always kept intact.
+func highlight(language, text string) string {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return html.EscapeString(text)
+	}
+	words := highlightKeywords[language]
+	isWord := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	var b strings.Builder
+	plain := 0 // the start of the text not written yet
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		wordStart := i == 0 || !isWord(text[i-1])
+		class, end := "", 0
+		switch {
+		case syntax.blockStart != "" && strings.HasPrefix(rest, syntax.blockStart):
+			class, end = "c", len(rest)
+			if close := strings.Index(rest[len(syntax.blockStart):], syntax.blockEnd); close >= 0 {
+				end = close + len(syntax.blockStart) + len(syntax.blockEnd)
+			}
+		case lineComment(syntax, rest, i == 0 || strings.IndexByte(" \t\n", text[i-1]) >= 0):
+			class, end = "c", len(rest)
+			if newline := strings.IndexByte(rest, '\n'); newline >= 0 {
+				end = newline
+			}
+		case strings.IndexByte(syntax.quotes, rest[0]) >= 0:
+			class = "s"
+			switch {
+			case syntax.triple && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''")):
+				end = len(rest)
+				if close := strings.Index(rest[3:], rest[:3]); close >= 0 {
+					end = close + 6
+				}
+			case rest[0] == '\'' && syntax.lifetimes:
+				end = len(rustChar.FindString(rest))
+			default:
+				end = stringEnd(rest)
+			}
+		case rest[0] >= '0' && rest[0] <= '9' && wordStart:
+			class, end = "n", 1
+			for end < len(rest) && (isWord(rest[end]) || rest[end] == '.') {
+				end++
+			}
+		case isWord(rest[0]) && wordStart:
+			end = 1
+			for end < len(rest) && isWord(rest[end]) {
+				end++
+			}
+			if words[rest[:end]] {
+				class = "k"
+			}
+		}
+		if class == "" || end == 0 {
+			i += max(end, 1)
+			continue
+		}
+		b.WriteString(html.EscapeString(text[plain:i]))
+		fmt.Fprintf(&b, "<span class=\"%s\">%s</span>", class, html.EscapeString(rest[:end]))
+		i += end
+		plain = i
+	}
+	b.WriteString(html.EscapeString(text[plain:]))
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package collect
+
+import (
+	"path"
+	"strings"
+)
+
+// languages maps file extensions to the language name reported for them.
+var languages = map[string]string{
+	".go":     "Go",
+	".py":     "Python",
+	".js":     "JavaScript",
+	".jsx":    "JavaScript",
+	".mjs":    "JavaScript",
+	".cjs":    "JavaScript",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".java":   "Java",
+	".kt":     "Kotlin",
+	".kts":    "Kotlin",
+	".scala":  "Scala",
+	".rs":     "Rust",
+	".c":      "C",
+	".h":      "C",
+	".cpp":    "C++",
+	".cc":     "C++",
+	".cxx":    "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".fs":     "F#",
+	".swift":  "Swift",
+	".m":      "Objective-C",
+	".rb":     "Ruby",
+	".php":    "PHP",
+	".pl":     "Perl",
+	".lua":    "Lua",
+	".r":      "R",
+	".dart":   "Dart",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".erl":    "Erlang",
+	".hs":     "Haskell",
+	".clj":    "Clojure",
+	".sh":     "Shell",
+	".bash":   "Shell",
+	".zsh":    "Shell",
+	".fish":   "Shell",
+	".ps1":    "PowerShell",
+	".sql":    "SQL",
+	".html":   "HTML",
+	".htm":    "HTML",
+	".css":    "CSS",
+	".scss":   "SCSS",
+	".less":   "Less",
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	".json":   "JSON",
+	".yaml":   "YAML",
+	".yml":    "YAML",
+	".toml":   "TOML",
+	".xml":    "XML",
+	".proto":  "Protocol Buffers",
+	".tf":     "HCL",
+	".md":     "Markdown",
+	".rst":    "reStructuredText",
+	".txt":    "Text",
+}
+
+// languageForPath returns the language of a file based on its extension, or
+// an empty string if it is not known.
+func languageForPath(p string) string {
+	switch strings.ToLower(path.Base(p)) {
+	case "dockerfile":
+		return "Dockerfile"
+	case "makefile":
+		return "Makefile"
+	}
+	return languages[strings.ToLower(path.Ext(p))]
+}
@@ -0,0 +1,80 @@
+package collect
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Manifest describes which files a collection contained. Content is only
+// filled in for FormatJSON output.
+type Manifest struct {
+	Root        string          `json:"root"`
+	TotalTokens int             `json:"total_tokens"`
+	Files       []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry is a collected file in a Manifest.
+type ManifestEntry struct {
+	Path    string `json:"path"`
+	Tokens  int    `json:"tokens"`
+	Size    int64  `json:"size"`
+	Hash    string `json:"sha256,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Manifest lists the collected files in path order.
+func (r Result) Manifest() Manifest {
+	m := Manifest{Root: r.Root, TotalTokens: r.TotalTokens, Files: []ManifestEntry{}}
+	for _, stat := range r.Files {
+		if stat.Status != StatusCollected {
+			continue
+		}
+		m.Files = append(m.Files, ManifestEntry{Path: stat.Path, Tokens: stat.Tokens, Size: stat.Bytes, Hash: stat.Hash})
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m
+}
+
+// CompareManifests prints the files added, removed and changed in current
+// relative to baseline, and returns the net token difference. A file has
+// changed if its token count or, where both manifests record it, its hash
+// differs.
+func CompareManifests(w io.Writer, baseline, current Manifest) int {
+	before := make(map[string]ManifestEntry, len(baseline.Files))
+	for _, entry := range baseline.Files {
+		before[entry.Path] = entry
+	}
+	after := make(map[string]ManifestEntry, len(current.Files))
+	for _, entry := range current.Files {
+		after[entry.Path] = entry
+	}
+
+	var added, removed, changed []string
+	for _, entry := range current.Files {
+		old, ok := before[entry.Path]
+		if !ok {
+			added = append(added, fmt.Sprintf("  + %s (%d tokens)", entry.Path, entry.Tokens))
+		} else if old.Tokens != entry.Tokens || old.Hash != "" && entry.Hash != "" && old.Hash != entry.Hash {
+			changed = append(changed, fmt.Sprintf("  ~ %s (%d -> %d tokens, %+d)", entry.Path, old.Tokens, entry.Tokens, entry.Tokens-old.Tokens))
+		}
+	}
+	for _, entry := range baseline.Files {
+		if _, ok := after[entry.Path]; !ok {
+			removed = append(removed, fmt.Sprintf("  - %s (%d tokens)", entry.Path, entry.Tokens))
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	fmt.Fprintf(w, "Compared with baseline: %d added, %d removed, %d changed\n", len(added), len(removed), len(changed))
+	for _, group := range [][]string{added, removed, changed} {
+		for _, line := range group {
+			fmt.Fprintln(w, line)
+		}
+	}
+	net := current.TotalTokens - baseline.TotalTokens
+	fmt.Fprintf(w, "Net token difference: %+d (%d -> %d)\n", net, baseline.TotalTokens, current.TotalTokens)
+	return net
+}
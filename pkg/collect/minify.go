@@ -0,0 +1,216 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// minifyData compacts a JSON, YAML or XML file in language, returning text
+// unchanged for other languages or when it cannot be parsed. If sample is
+// positive, arrays and sequences longer than that keep their first sample
+// elements and a note of how many there were.
+func minifyData(language, text string, sample int) string {
+	switch language {
+	case "JSON":
+		if minified, err := minifyJSON(text, sample); err == nil {
+			return minified
+		}
+	case "YAML":
+		return minifyYAML(text, sample)
+	case "XML":
+		return minifyXML(text)
+	}
+	return text
+}
+
+// sampleNote stands in for the elements left out of an array.
+func sampleNote(kept, total int) string {
+	return fmt.Sprintf("[first %d of %d elements]", kept, total)
+}
+
+// minifyJSON re-encodes JSON without insignificant whitespace, keeping the
+// order of object keys and the spelling of numbers. Several values in a row
+// come out one per line.
+func minifyJSON(text string, sample int) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+
+	// containers holds an entry for every array and object being written.
+	type container struct {
+		object   bool
+		elements int // values in an array, keys and values in an object
+		skipped  int // elements of an array left out
+	}
+	var containers []container
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		top := len(containers) - 1
+		if delim, ok := tok.(json.Delim); ok && (delim == ']' || delim == '}') {
+			if c := containers[top]; c.skipped > 0 {
+				out.WriteString(`,"` + sampleNote(c.elements, c.elements+c.skipped) + `"`)
+			}
+			out.WriteByte(byte(delim))
+			containers = containers[:top]
+			if top == 0 {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+
+		if top >= 0 {
+			c := &containers[top]
+			if !c.object && sample > 0 && c.elements >= sample {
+				c.skipped++
+				if err := skipJSONValue(decoder, tok); err != nil {
+					return "", err
+				}
+				continue
+			}
+			switch {
+			case c.object && c.elements%2 == 1:
+				out.WriteByte(':')
+			case c.elements > 0:
+				out.WriteByte(',')
+			}
+			c.elements++
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(tok))
+			containers = append(containers, container{object: tok == '{'})
+			continue
+		case string:
+			if err := encoder.Encode(tok); err != nil {
+				return "", err
+			}
+			// Encode ends every value with a newline.
+			out.Truncate(out.Len() - 1)
+		case json.Number:
+			out.WriteString(tok.String())
+		case bool:
+			fmt.Fprint(&out, tok)
+		case nil:
+			out.WriteString("null")
+		}
+		if top < 0 {
+			out.WriteByte('\n')
+		}
+	}
+	return out.String(), nil
+}
+
+// skipJSONValue reads past the rest of the value starting with tok.
+func skipJSONValue(decoder *json.Decoder, tok json.Token) error {
+	if delim, ok := tok.(json.Delim); !ok || delim == ']' || delim == '}' {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		tok, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// yamlBlockScalar matches a line that starts a literal or folded block
+// scalar, whose more indented lines below are text to keep as it is.
+var yamlBlockScalar = regexp.MustCompile(`(^|[:\-]\s+)[|>][-+0-9]*\s*(#.*)?$`)
+
+// minifyYAML drops the comments, blank lines and trailing whitespace of YAML,
+// whose indentation is part of its syntax and stays. If sample is positive,
+// sequences longer than that keep their first sample items and a comment of
+// how many there were.
+func minifyYAML(text string, sample int) string {
+	lines := strings.SplitAfter(text, "\n")
+	var b strings.Builder
+	blockIndent := -1 // the indentation of the line starting a block scalar
+	// A sequence is tracked by the indentation of its dashes.
+	type sequence struct {
+		indent, items int
+	}
+	var sequences []sequence
+	skipping := -1 // the indentation of the sequence whose items are left out
+	closeSequences := func(indent int, isItem bool) {
+		for n := len(sequences); n > 0; n = len(sequences) {
+			s := sequences[n-1]
+			if s.indent < indent || s.indent == indent && isItem {
+				return
+			}
+			if skipping == s.indent {
+				skipping = -1
+			}
+			// A sequence inside the items left out is left out with them.
+			if skipping < 0 && sample > 0 && s.items > sample {
+				b.WriteString(strings.Repeat(" ", s.indent) + "# " + sampleNote(sample, s.items) + "\n")
+			}
+			sequences = sequences[:n-1]
+		}
+	}
+	for _, line := range lines {
+		content := strings.TrimRight(line, " \t\r\n")
+		trimmed := strings.TrimLeft(content, " ")
+		indent := len(content) - len(trimmed)
+		if blockIndent >= 0 {
+			if trimmed == "" || indent > blockIndent {
+				if skipping < 0 {
+					b.WriteString(content + "\n")
+				}
+				continue
+			}
+			blockIndent = -1
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		isItem := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+		closeSequences(indent, isItem)
+		if isItem {
+			if n := len(sequences); n > 0 && sequences[n-1].indent == indent {
+				sequences[n-1].items++
+			} else {
+				sequences = append(sequences, sequence{indent: indent, items: 1})
+			}
+			if s := sequences[len(sequences)-1]; sample > 0 && s.items > sample && skipping < 0 {
+				skipping = indent
+			}
+		}
+		if yamlBlockScalar.MatchString(trimmed) {
+			blockIndent = indent
+		}
+		if skipping < 0 {
+			b.WriteString(content + "\n")
+		}
+	}
+	closeSequences(0, false)
+	return b.String()
+}
+
+// xmlBetweenTags matches the whitespace between two tags.
+var xmlBetweenTags = regexp.MustCompile(`>\s+<`)
+
+// minifyXML drops the indentation and line breaks between tags. Whitespace
+// next to text is kept, since it may be part of it.
+func minifyXML(text string) string {
+	return strings.TrimSpace(xmlBetweenTags.ReplaceAllString(text, "><")) + "\n"
+}
@@ -0,0 +1,67 @@
+package collect
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// Mount returns a file system that serves the files of sub below dir, a
+// slash-separated path, and those of fsys everywhere else, so that files
+// from outside the root, such as the sources of a dependency, can be
+// collected along with it by adding dir to the roots. The result is a
+// LinkFS if both fsys and sub are.
+func Mount(fsys fs.FS, dir string, sub fs.FS) fs.FS {
+	m := mountFS{fsys: fsys, dir: dir, sub: sub}
+	if _, ok := fsys.(LinkFS); ok {
+		if _, ok := sub.(LinkFS); ok {
+			return linkMountFS{m}
+		}
+	}
+	return m
+}
+
+type mountFS struct {
+	fsys fs.FS
+	dir  string
+	sub  fs.FS
+}
+
+// resolve returns the file system serving name and its path within it.
+func (m mountFS) resolve(name string) (fs.FS, string) {
+	if name == m.dir {
+		return m.sub, "."
+	}
+	if rest, ok := strings.CutPrefix(name, m.dir+"/"); ok {
+		return m.sub, rest
+	}
+	return m.fsys, name
+}
+
+func (m mountFS) Open(name string) (fs.File, error) {
+	fsys, name := m.resolve(name)
+	return fsys.Open(name)
+}
+
+func (m mountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys, name := m.resolve(name)
+	return fs.ReadDir(fsys, name)
+}
+
+func (m mountFS) ReadFile(name string) ([]byte, error) {
+	fsys, name := m.resolve(name)
+	return fs.ReadFile(fsys, name)
+}
+
+func (m mountFS) Stat(name string) (fs.FileInfo, error) {
+	fsys, name := m.resolve(name)
+	return fs.Stat(fsys, name)
+}
+
+type linkMountFS struct {
+	mountFS
+}
+
+func (m linkMountFS) ReadLink(name string) (string, error) {
+	fsys, name := m.resolve(name)
+	return fsys.(LinkFS).ReadLink(name)
+}
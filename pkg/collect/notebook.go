@@ -0,0 +1,168 @@
+package collect
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// notebook is the part of a Jupyter notebook extractNotebook reads. Cells
+// are in Cells since nbformat 4 and in the worksheets before.
+type notebook struct {
+	Cells      []notebookCell `json:"cells"`
+	Worksheets []struct {
+		Cells []notebookCell `json:"cells"`
+	} `json:"worksheets"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name          string `json:"name"`
+			FileExtension string `json:"file_extension"`
+		} `json:"language_info"`
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+}
+
+type notebookCell struct {
+	CellType string           `json:"cell_type"`
+	Source   notebookText     `json:"source"`
+	Input    notebookText     `json:"input"` // the source before nbformat 4
+	Outputs  []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+// notebookText is text stored either as one string or as a list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// Data such as application/json outputs is neither, and not text.
+		*t = ""
+		return nil
+	}
+	*t = notebookText(s)
+	return nil
+}
+
+// ansiEscape matches the terminal color codes in tracebacks.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// extractNotebook returns the source of a Jupyter notebook in the percent
+// format that editors and jupytext read: each cell starts with a "# %%"
+// line, and the markdown cells are kept as comments. This drops the JSON
+// and the outputs, whose images, stored as base64, are often most of a
+// notebook's size. KeepOutputs keeps the text outputs as comments after
+// their cell.
+func (c *Collector) extractNotebook(data []byte) (string, string, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return "", "", err
+	}
+	cells := nb.Cells
+	for _, sheet := range nb.Worksheets {
+		cells = append(cells, sheet.Cells...)
+	}
+	if cells == nil {
+		return "", "", errors.New("not a Jupyter notebook")
+	}
+
+	language := languages[strings.ToLower(nb.Metadata.LanguageInfo.FileExtension)]
+	if language == "" {
+		for _, name := range []string{nb.Metadata.LanguageInfo.Name, nb.Metadata.Kernelspec.Language} {
+			if name == "" {
+				continue
+			}
+			for _, known := range languages {
+				if strings.EqualFold(known, name) {
+					language = known
+				}
+			}
+		}
+	}
+	if language == "" {
+		language = "Python"
+	}
+	comment := "#"
+	if syntax, ok := commentSyntaxes[language]; ok && len(syntax.line) > 0 {
+		comment = syntax.line[0]
+	}
+	commented := func(b *strings.Builder, text string) {
+		for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+			if line = strings.TrimRight(line, " \t\r"); line == "" {
+				b.WriteString(comment + "\n")
+			} else {
+				b.WriteString(comment + " " + line + "\n")
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, cell := range cells {
+		source := string(cell.Source)
+		if source == "" {
+			source = string(cell.Input)
+		}
+		if strings.TrimSpace(source) == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		switch cell.CellType {
+		case "code":
+			b.WriteString(comment + " %%\n")
+			b.WriteString(strings.TrimRight(source, "\n") + "\n")
+		case "raw":
+			b.WriteString(comment + " %% [raw]\n")
+			commented(&b, source)
+		default:
+			b.WriteString(comment + " %% [markdown]\n")
+			commented(&b, source)
+		}
+		if !c.KeepOutputs {
+			continue
+		}
+		var outputs []string
+		for _, output := range cell.Outputs {
+			switch output.OutputType {
+			case "stream":
+				outputs = append(outputs, string(output.Text))
+			case "execute_result", "display_data", "pyout":
+				if text, ok := output.Data["text/plain"]; ok {
+					outputs = append(outputs, string(text))
+				} else if text := output.Text; text != "" {
+					outputs = append(outputs, string(text))
+				}
+			case "error", "pyerr":
+				outputs = append(outputs, ansiEscape.ReplaceAllString(strings.Join(output.Traceback, "\n"), ""))
+				if len(output.Traceback) == 0 {
+					outputs = append(outputs, output.Ename+": "+output.Evalue)
+				}
+			}
+		}
+		for i := range outputs {
+			outputs[i] = strings.TrimRight(outputs[i], "\n")
+		}
+		if text := strings.Trim(strings.Join(outputs, "\n"), "\n"); strings.TrimSpace(text) != "" {
+			b.WriteString(comment + " Output:\n")
+			commented(&b, text)
+		}
+	}
+	return b.String(), language, nil
+}
@@ -0,0 +1,337 @@
+package collect
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// outliners reduce a source file to its outline, by extension.
+var outliners = map[string]func(p, src string) (string, error){
+	".go":    outlineGo,
+	".py":    outlinePython,
+	".pyi":   outlinePython,
+	".js":    outlineBraces(jsSyntax),
+	".jsx":   outlineBraces(jsSyntax),
+	".mjs":   outlineBraces(jsSyntax),
+	".cjs":   outlineBraces(jsSyntax),
+	".ts":    outlineBraces(jsSyntax),
+	".tsx":   outlineBraces(jsSyntax),
+	".mts":   outlineBraces(jsSyntax),
+	".cts":   outlineBraces(jsSyntax),
+	".java":  outlineBraces(cSyntax),
+	".cs":    outlineBraces(cSyntax),
+	".kt":    outlineBraces(cSyntax),
+	".kts":   outlineBraces(cSyntax),
+	".scala": outlineBraces(cSyntax),
+	".swift": outlineBraces(cSyntax),
+	".rs":    outlineBraces(rustSyntax),
+}
+
+// outliner returns the outliner for p, or nil if its language has none.
+func outliner(p string) func(p, src string) (string, error) {
+	return outliners[strings.ToLower(path.Ext(p))]
+}
+
+// outlineGo keeps the package documentation, imports, constants, variables,
+// types and function signatures of a Go file, dropping the function bodies
+// and the comments inside them.
+func outlineGo(p, src string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, p, src, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+	// The comments are mapped to their nodes before the bodies go, so that
+	// only those attached to what is left are kept.
+	comments := ast.NewCommentMap(fset, file, file.Comments)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			fn.Body = nil
+		}
+	}
+	file.Comments = comments.Filter(file).Comments()
+
+	var b strings.Builder
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := config.Fprint(&b, fset, file); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// braceSyntax describes the lexical rules outlineBraces needs to tell code
+// from strings and comments.
+type braceSyntax struct {
+	// templates means backquoted strings, as in JavaScript.
+	templates bool
+	// lifetimes means a single quote only starts a character literal if it
+	// closes right after, as Rust uses unpaired quotes for lifetimes.
+	lifetimes bool
+}
+
+var (
+	cSyntax    = braceSyntax{}
+	jsSyntax   = braceSyntax{templates: true}
+	rustSyntax = braceSyntax{lifetimes: true}
+)
+
+// containerDecl matches the start of a declaration whose braces hold more
+// declarations, such as a class or an impl block, rather than code.
+var containerDecl = regexp.MustCompile(`\b(?:class|interface|enum|struct|trait|impl|mod|namespace|module|object|record|union|extension|protocol)\b|^\s*(?:export\s+)?(?:declare\s+)?type\s+\w+[^=]*=\s*$`)
+
+// keptBraces matches the other places where braces are kept: import and
+// export lists, Rust use trees, and type literals after a colon, as in a
+// TypeScript return type.
+var keptBraces = regexp.MustCompile(`^\s*(?:import|export)(?:\s+type)?\s*$|\buse\s[^;]*::\s*$|:\s*$`)
+
+// rustChar matches a Rust character literal at the start of the input.
+var rustChar = regexp.MustCompile(`^'(?:[^'\\]|\\(?:u\{[0-9a-fA-F]+\}|x[0-9a-fA-F]{2}|.))'`)
+
+// outlineBraces returns an outliner for languages that delimit blocks with
+// braces. The bodies of classes, interfaces, structs and similar containers
+// are kept, while every other block, such as a function body, is collapsed
+// to { ... }. It is a lexical heuristic rather than a parser, so it works on
+// any dialect but can misjudge unusual code.
+func outlineBraces(syntax braceSyntax) func(p, src string) (string, error) {
+	return func(p, src string) (string, error) {
+		var out, header strings.Builder
+		skipDepth := 0
+		emit := func(text string) {
+			if skipDepth == 0 {
+				out.WriteString(text)
+			}
+		}
+		for i := 0; i < len(src); {
+			rest := src[i:]
+			switch {
+			case strings.HasPrefix(rest, "//"):
+				end := strings.IndexByte(rest, '\n')
+				if end < 0 {
+					end = len(rest)
+				}
+				emit(rest[:end])
+				i += end
+				continue
+			case strings.HasPrefix(rest, "/*"):
+				end := strings.Index(rest[2:], "*/")
+				if end < 0 {
+					end = len(rest)
+				} else {
+					end += 4
+				}
+				emit(rest[:end])
+				i += end
+				continue
+			case rest[0] == '"' || (rest[0] == '`' && syntax.templates) || (rest[0] == '\'' && !syntax.lifetimes):
+				end := stringEnd(rest)
+				emit(rest[:end])
+				// Strings are left out of the header, so that one
+				// containing "class" does not make a container.
+				header.WriteString(`""`)
+				i += end
+				continue
+			case rest[0] == '\'' && syntax.lifetimes:
+				if char := rustChar.FindString(rest); char != "" {
+					emit(char)
+					i += len(char)
+					continue
+				}
+			}
+
+			ch := src[i]
+			i++
+			if skipDepth > 0 {
+				switch ch {
+				case '{':
+					skipDepth++
+				case '}':
+					skipDepth--
+					if skipDepth == 0 {
+						out.WriteString("}")
+					}
+				}
+				continue
+			}
+			switch ch {
+			case '{':
+				if h := header.String(); containerDecl.MatchString(h) || keptBraces.MatchString(h) {
+					out.WriteByte('{')
+				} else {
+					out.WriteString("{ ... ")
+					skipDepth = 1
+				}
+				header.Reset()
+			case '}', ';':
+				out.WriteByte(ch)
+				header.Reset()
+			default:
+				out.WriteByte(ch)
+				header.WriteByte(ch)
+			}
+		}
+		return tidyOutline(out.String()), nil
+	}
+}
+
+// stringEnd returns the length of the string literal at the start of s,
+// which begins with its quote.
+func stringEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			// Only backquoted strings span lines; anything else is a
+			// stray quote, and the string ends with the line.
+			if quote != '`' {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// pythonBlock matches the compound statements whose bodies outlinePython
+// drops at module level.
+var pythonBlock = regexp.MustCompile(`^(?:if|elif|else|for|while|try|except|finally|with|match|async\s+(?:for|with))\b`)
+
+// outlinePython keeps the imports, module-level assignments, classes and
+// their attributes, and the signatures and docstrings of functions, whose
+// bodies are replaced with "...". Module-level statements such as
+// if __name__ == "__main__" blocks are dropped.
+func outlinePython(p, src string) (string, error) {
+	lines := strings.Split(src, "\n")
+	var out []string
+	skipBelow := -1
+	skippedBlank := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if skipBelow >= 0 {
+			if trimmed == "" || indent > skipBelow {
+				skippedBlank = skippedBlank || trimmed == ""
+				continue
+			}
+			skipBelow = -1
+			// Keep the blank line that separated the dropped body from
+			// what follows.
+			if skippedBlank {
+				out = append(out, "")
+			}
+		}
+		skippedBlank = false
+
+		isDef := strings.HasPrefix(trimmed, "def ") || strings.HasPrefix(trimmed, "async def ")
+		switch {
+		case isDef || strings.HasPrefix(trimmed, "class "):
+			last, rest := pythonHeaderEnd(lines, i)
+			out = append(out, lines[i:last+1]...)
+			i = last
+			if !isDef || rest != "" {
+				// A class body is outlined line by line; a function
+				// on one line is kept as it is.
+				continue
+			}
+			body := i + 1
+			for body < len(lines) && strings.TrimSpace(lines[body]) == "" {
+				body++
+			}
+			bodyIndent := strings.Repeat(" ", indent+4)
+			if body < len(lines) {
+				if next := lines[body]; len(next)-len(strings.TrimLeft(next, " \t")) > indent {
+					bodyIndent = next[:len(next)-len(strings.TrimLeft(next, " \t"))]
+					if end := pythonDocstringEnd(lines, body); end >= 0 {
+						out = append(out, lines[body:end+1]...)
+					}
+				}
+			}
+			out = append(out, bodyIndent+"...")
+			skipBelow = indent
+		case indent == 0 && pythonBlock.MatchString(trimmed):
+			skipBelow = 0
+		default:
+			out = append(out, line)
+		}
+	}
+	return tidyOutline(strings.Join(out, "\n")), nil
+}
+
+// pythonHeaderEnd finds the colon ending the def or class header starting on
+// line start, which may span lines inside brackets. It returns the line it is
+// on and any code following it on that line.
+func pythonHeaderEnd(lines []string, start int) (int, string) {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		for j := 0; j < len(line); j++ {
+			switch c := line[j]; c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth--
+			case '"', '\'':
+				j += stringEnd(line[j:]) - 1
+			case '#':
+				j = len(line)
+			case ':':
+				if depth == 0 {
+					return i, strings.TrimSpace(line[j+1:])
+				}
+			}
+		}
+	}
+	return len(lines) - 1, ""
+}
+
+// pythonDocstringEnd returns the last line of the docstring starting on
+// line start, or -1 if the line does not start one.
+func pythonDocstringEnd(lines []string, start int) int {
+	trimmed := strings.TrimLeft(strings.TrimSpace(lines[start]), "rRuU")
+	for _, quote := range []string{`"""`, "'''"} {
+		if !strings.HasPrefix(trimmed, quote) {
+			continue
+		}
+		if strings.Count(trimmed, quote) >= 2 {
+			return start
+		}
+		for i := start + 1; i < len(lines); i++ {
+			if strings.Contains(lines[i], quote) {
+				return i
+			}
+		}
+		return len(lines) - 1
+	}
+	if strings.HasPrefix(trimmed, `"`) || strings.HasPrefix(trimmed, "'") {
+		return start
+	}
+	return -1
+}
+
+// tidyOutline strips trailing whitespace and collapses the runs of blank
+// lines that removing code leaves behind.
+func tidyOutline(text string) string {
+	var out []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if blank || len(out) == 0 {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.TrimRight(strings.Join(out, "\n"), "\n") + "\n"
+}
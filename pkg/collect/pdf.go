@@ -0,0 +1,853 @@
+package collect
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// extractPDF returns the text of a PDF document, page by page. It reads the
+// text drawn by the content streams of the pages and the forms they use,
+// decoded through the fonts' ToUnicode maps where there are any, and starts a
+// new line wherever the text moves down. Layout beyond that, such as columns
+// and tables, is lost, and scanned pages have no text to extract.
+func extractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", errors.New("the PDF is encrypted")
+	}
+	doc := parsePDF(data)
+	var text pdfText
+	for _, page := range doc.pages() {
+		contents, err := doc.contents(page.dict["Contents"])
+		if err != nil {
+			return "", err
+		}
+		doc.showText(&text, contents, page.resources, 0)
+		text.paragraph()
+	}
+	out := tidyText(text.b.String())
+	if out == "" {
+		return "", errors.New("no text found; the pages may be scanned images")
+	}
+	return out, nil
+}
+
+// tidyText trims the spaces ending lines and collapses runs of blank lines,
+// for text whose spacing was reconstructed.
+func tidyText(text string) string {
+	lines := strings.Split(text, "\n")
+	var b strings.Builder
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank++
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+			if blank > 0 {
+				b.WriteByte('\n')
+			}
+		}
+		blank = 0
+		b.WriteString(line)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return b.String() + "\n"
+}
+
+// The objects of a PDF file, as parsed by pdfLexer.object: nil, bool,
+// float64, pdfString, pdfName, pdfKeyword, []any, pdfDict, pdfRef and
+// *pdfStream.
+type (
+	pdfString  string
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte // still encoded
+	}
+)
+
+// pdfLexer reads the tokens and objects of a PDF file or content stream.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch b := l.data[l.pos]; {
+		case b == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case isPDFSpace(b):
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// token returns the next token: a number, string, name or keyword, where
+// the delimiters of arrays and dictionaries count as keywords.
+func (l *pdfLexer) token() (any, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	switch b := l.data[l.pos]; b {
+	case '(':
+		return l.literalString(), true
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), true
+		}
+		return l.hexString(), true
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), true
+		}
+	case '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		// #xx escapes a byte in a name.
+		var name []byte
+		for i := start; i < l.pos; i++ {
+			if l.data[i] == '#' && i+2 < l.pos {
+				if v, err := strconv.ParseUint(string(l.data[i+1:i+3]), 16, 8); err == nil {
+					name = append(name, byte(v))
+					i += 2
+					continue
+				}
+			}
+			name = append(name, l.data[i])
+		}
+		return pdfName(name), true
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		// A delimiter of its own, such as [ or a stray ).
+		l.pos++
+		return pdfKeyword(l.data[start:l.pos]), true
+	}
+	word := string(l.data[start:l.pos])
+	if strings.IndexByte("+-.0123456789", word[0]) >= 0 {
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			return n, true
+		}
+	}
+	return pdfKeyword(word), true
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var b []byte
+	for depth := 1; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				l.pos++
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos++; l.pos >= len(l.data) {
+				break
+			}
+			switch c = l.data[l.pos]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A backslash at the end of a line continues the string.
+				if l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := 0
+					for n := 0; n < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; n++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					l.pos--
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // <
+	var digits []byte
+	for ; l.pos < len(l.data) && l.data[l.pos] != '>'; l.pos++ {
+		if !isPDFSpace(l.data[l.pos]) {
+			digits = append(digits, l.data[l.pos])
+		}
+	}
+	l.pos++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(b, digits)
+	return pdfString(b[:n])
+}
+
+// object returns the next object, reading arrays, dictionaries and
+// references whole.
+func (l *pdfLexer) object() (any, bool) {
+	tok, ok := l.token()
+	if !ok {
+		return nil, false
+	}
+	return l.objectFrom(tok), true
+}
+
+func (l *pdfLexer) objectFrom(tok any) any {
+	switch tok := tok.(type) {
+	case pdfKeyword:
+		switch tok {
+		case "<<":
+			dict := pdfDict{}
+			for {
+				key, ok := l.token()
+				if !ok || key == pdfKeyword(">>") {
+					return dict
+				}
+				name, isName := key.(pdfName)
+				if !isName {
+					continue
+				}
+				value, ok := l.object()
+				if !ok || value == pdfKeyword(">>") {
+					return dict
+				}
+				dict[name] = value
+			}
+		case "[":
+			array := []any{}
+			for {
+				tok, ok := l.token()
+				if !ok || tok == pdfKeyword("]") {
+					return array
+				}
+				array = append(array, l.objectFrom(tok))
+			}
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+	case float64:
+		// "12 0 R" refers to object 12.
+		if tok >= 0 && tok == math.Trunc(tok) {
+			save := l.pos
+			gen, _ := l.token()
+			r, _ := l.token()
+			if g, isNumber := gen.(float64); isNumber && r == pdfKeyword("R") {
+				return pdfRef{int(tok), int(g)}
+			}
+			l.pos = save
+		}
+	}
+	return tok
+}
+
+// pdfDoc holds the objects of a PDF file by number.
+type pdfDoc struct {
+	objects map[int]any
+	fonts   map[pdfRef]*pdfFont
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// parsePDF reads every object in data, those packed into object streams
+// included. Rather than trusting the cross-reference table, which damaged
+// files get wrong, it scans for the objects, so that the last definition of
+// each, as left by incremental updates, wins.
+func parsePDF(data []byte) *pdfDoc {
+	doc := &pdfDoc{objects: make(map[int]any), fonts: make(map[pdfRef]*pdfFont)}
+	for pos := 0; pos < len(data); {
+		m := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+m[2] : pos+m[3]]))
+		l := &pdfLexer{data: data, pos: pos + m[1]}
+		obj, _ := l.object()
+		if dict, isDict := obj.(pdfDict); isDict {
+			save := l.pos
+			if tok, _ := l.token(); tok == pdfKeyword("stream") {
+				stream := &pdfStream{dict: dict}
+				stream.data, l.pos = streamData(data, l.pos, dict)
+				obj = stream
+			} else {
+				l.pos = save
+			}
+		}
+		doc.objects[num] = obj
+		pos = l.pos
+	}
+
+	for _, num := range doc.numbers() {
+		stream, isStream := doc.objects[num].(*pdfStream)
+		if !isStream || doc.resolve(stream.dict["Type"]) != pdfName("ObjStm") {
+			continue
+		}
+		data, err := doc.decode(stream)
+		if err != nil {
+			continue
+		}
+		n, _ := doc.resolve(stream.dict["N"]).(float64)
+		first, _ := doc.resolve(stream.dict["First"]).(float64)
+		if int(first) > len(data) {
+			continue
+		}
+		header := &pdfLexer{data: data[:int(first)]}
+		for i := 0; i < int(n); i++ {
+			num, _ := header.token()
+			offset, _ := header.token()
+			objNum, ok1 := num.(float64)
+			objOffset, ok2 := offset.(float64)
+			if !ok1 || !ok2 || int(first+objOffset) >= len(data) {
+				break
+			}
+			if obj, defined := doc.objects[int(objNum)]; defined && obj != nil {
+				continue
+			}
+			l := &pdfLexer{data: data, pos: int(first + objOffset)}
+			obj, _ := l.object()
+			doc.objects[int(objNum)] = obj
+		}
+	}
+	return doc
+}
+
+// streamData returns the data of the stream starting at pos, just after its
+// stream keyword, and the position after it. A direct Length that matches
+// is trusted, and otherwise the data runs up to endstream.
+func streamData(data []byte, pos int, dict pdfDict) ([]byte, int) {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && pos+int(length) <= len(data) {
+		end := pos + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(data[end:], " \t\r\n"), []byte("endstream")) {
+			return data[pos:end], end
+		}
+	}
+	i := bytes.Index(data[pos:], []byte("endstream"))
+	if i < 0 {
+		return data[pos:], len(data)
+	}
+	return bytes.TrimRight(data[pos:pos+i], "\r\n"), pos + i + len("endstream")
+}
+
+// numbers returns the object numbers in order.
+func (d *pdfDoc) numbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// resolve follows references to the object they refer to.
+func (d *pdfDoc) resolve(obj any) any {
+	for hops := 0; hops < 32; hops++ {
+		ref, isRef := obj.(pdfRef)
+		if !isRef {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDoc) dict(obj any) pdfDict {
+	switch obj := d.resolve(obj).(type) {
+	case pdfDict:
+		return obj
+	case *pdfStream:
+		return obj.dict
+	}
+	return nil
+}
+
+// decode returns the data of stream with its filters undone.
+func (d *pdfDoc) decode(stream *pdfStream) ([]byte, error) {
+	var filters []any
+	switch filter := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case []any:
+		filters = filter
+	}
+	data := stream.data
+	for _, filter := range filters {
+		switch name, _ := d.resolve(filter).(pdfName); name {
+		case "FlateDecode", "Fl":
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Streams cut short keep what could be inflated.
+			out, err := io.ReadAll(r)
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		case "ASCIIHexDecode", "AHx":
+			l := &pdfLexer{data: append(append([]byte("<"), data...), '>')}
+			data = []byte(l.hexString())
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			out, err := io.ReadAll(ascii85.NewDecoder(bytes.NewReader(data)))
+			if err != nil {
+				return nil, err
+			}
+			data = out
+		default:
+			return nil, fmt.Errorf("unsupported PDF filter %s", name)
+		}
+	}
+	return data, nil
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns the pages in order, each with the resources it uses, which
+// may be inherited from the page tree.
+func (d *pdfDoc) pages() []pdfPage {
+	var pages []pdfPage
+	visited := make(map[pdfRef]bool)
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, isRef := node.(pdfRef); isRef {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+		if r := d.dict(dict["Resources"]); r != nil {
+			resources = r
+		}
+		if kids, ok := d.resolve(dict["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+	for _, num := range d.numbers() {
+		if dict := d.dict(d.objects[num]); dict["Type"] == pdfName("Catalog") {
+			walk(dict["Pages"], nil, 0)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+	// Without a usable catalog, the pages are taken in object order.
+	for _, num := range d.numbers() {
+		if dict := d.dict(d.objects[num]); dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+		}
+	}
+	return pages
+}
+
+// contents returns a page's content streams decoded and joined.
+func (d *pdfDoc) contents(obj any) ([]byte, error) {
+	var streams []any
+	switch obj := d.resolve(obj).(type) {
+	case *pdfStream:
+		streams = []any{obj}
+	case []any:
+		streams = obj
+	}
+	var data []byte
+	for _, s := range streams {
+		stream, ok := d.resolve(s).(*pdfStream)
+		if !ok {
+			continue
+		}
+		decoded, err := d.decode(stream)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, decoded...), '\n')
+	}
+	return data, nil
+}
+
+// pdfFont decodes the strings shown in a font to text.
+type pdfFont struct {
+	// toUnicode maps character codes, as bytes, to their text.
+	toUnicode map[string]string
+	// codeLengths are the lengths of the character codes, in bytes.
+	codeLengths []int
+	// composite fonts without a ToUnicode map have codes that cannot be
+	// decoded without the font program.
+	composite bool
+}
+
+func (d *pdfDoc) font(obj any) *pdfFont {
+	ref, isRef := obj.(pdfRef)
+	if font, ok := d.fonts[ref]; isRef && ok {
+		return font
+	}
+	dict := d.dict(obj)
+	font := &pdfFont{codeLengths: []int{1}, composite: dict["Subtype"] == pdfName("Type0")}
+	if font.composite {
+		font.codeLengths = []int{2}
+	}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decode(stream); err == nil {
+			font.parseCMap(data)
+		}
+	}
+	if isRef {
+		d.fonts[ref] = font
+	}
+	return font
+}
+
+// parseCMap reads the code lengths and mappings of a ToUnicode CMap.
+func (f *pdfFont) parseCMap(data []byte) {
+	l := &pdfLexer{data: data}
+	f.toUnicode = make(map[string]string)
+	var lengths []int
+	var operands []any
+	for {
+		tok, ok := l.token()
+		if !ok {
+			break
+		}
+		switch tok {
+		case pdfKeyword("endcodespacerange"):
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(pdfString); ok && len(lo) > 0 && !slices.Contains(lengths, len(lo)) {
+					lengths = append(lengths, len(lo))
+				}
+			}
+		case pdfKeyword("endbfchar"):
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUnicode[string(src)] = decodeText([]byte(dst), EncodingUTF16BE)
+				}
+			}
+		case pdfKeyword("endbfrange"):
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := codeValue(lo), codeValue(hi)
+				for code := start; code <= end && code-start < 1<<16; code++ {
+					key := codeBytes(code, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfString:
+						// The last byte of the destination counts up.
+						text := []byte(dst)
+						if len(text) > 0 {
+							text = append([]byte{}, text...)
+							text[len(text)-1] += byte(code - start)
+						}
+						f.toUnicode[key] = decodeText(text, EncodingUTF16BE)
+					case []any:
+						if i := int(code - start); i < len(dst) {
+							if s, ok := dst[i].(pdfString); ok {
+								f.toUnicode[key] = decodeText([]byte(s), EncodingUTF16BE)
+							}
+						}
+					}
+				}
+			}
+		default:
+			if kw, isKeyword := tok.(pdfKeyword); isKeyword && kw != "[" {
+				operands = operands[:0]
+				continue
+			}
+			operands = append(operands, l.objectFrom(tok))
+			continue
+		}
+		operands = operands[:0]
+	}
+	if len(lengths) > 0 {
+		sort.Ints(lengths)
+		f.codeLengths = lengths
+	}
+}
+
+func codeValue(b pdfString) uint32 {
+	var v uint32
+	for i := 0; i < len(b); i++ {
+		v = v<<8 | uint32(b[i])
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// winAnsi holds the characters Windows-1252 puts at 0x80 to 0x9f, where
+// Latin-1 has control characters; simple fonts mostly use it.
+var winAnsi = []rune("€\x81‚ƒ„…†‡ˆ‰Š‹Œ\x8dŽ\x8f\x90‘’“”•–—˜™š›œ\x9džŸ")
+
+// decode returns the text s shows in the font.
+func (f *pdfFont) decode(s pdfString) string {
+	var b strings.Builder
+	if f.toUnicode == nil {
+		if f.composite {
+			return ""
+		}
+		for i := 0; i < len(s); i++ {
+			if c := s[i]; c < 0x20 {
+				continue
+			} else if c >= 0x80 && c <= 0x9f {
+				b.WriteRune(winAnsi[c-0x80])
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		return b.String()
+	}
+	for i := 0; i < len(s); {
+		n := f.codeLengths[0]
+		text, found := "", false
+		for _, length := range f.codeLengths {
+			if i+length <= len(s) {
+				if text, found = f.toUnicode[string(s[i:i+length])]; found {
+					n = length
+					break
+				}
+			}
+		}
+		b.WriteString(text)
+		i += n
+	}
+	return b.String()
+}
+
+// pdfText accumulates the text of a document, spaced out as it is drawn.
+type pdfText struct {
+	b strings.Builder
+}
+
+func (t *pdfText) last() byte {
+	s := t.b.String()
+	if s == "" {
+		return '\n'
+	}
+	return s[len(s)-1]
+}
+
+func (t *pdfText) space() {
+	if c := t.last(); c != ' ' && c != '\n' {
+		t.b.WriteByte(' ')
+	}
+}
+
+func (t *pdfText) newline() {
+	if t.last() != '\n' {
+		t.b.WriteByte('\n')
+	}
+}
+
+func (t *pdfText) paragraph() {
+	t.newline()
+	t.b.WriteByte('\n')
+}
+
+// maxFormDepth bounds how deeply forms drawing forms are followed.
+const maxFormDepth = 8
+
+// wordSpacing is the adjustment, in thousandths of the font size, beyond
+// which a gap in a TJ array is taken for a space between words.
+const wordSpacing = -200
+
+// showText appends the text that the content stream draws to t, using the
+// fonts and forms in resources.
+func (d *pdfDoc) showText(t *pdfText, content []byte, resources pdfDict, depth int) {
+	fonts := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+	font := &pdfFont{codeLengths: []int{1}}
+	show := func(obj any) {
+		if s, ok := obj.(pdfString); ok {
+			t.b.WriteString(font.decode(s))
+		}
+	}
+	number := func(operands []any, i int) float64 {
+		if i < len(operands) {
+			n, _ := operands[i].(float64)
+			return n
+		}
+		return 0
+	}
+	var y float64
+	l := &pdfLexer{data: content}
+	var operands []any
+	for {
+		tok, ok := l.token()
+		if !ok {
+			break
+		}
+		op, isOperator := tok.(pdfKeyword)
+		if !isOperator || op == "[" || op == "<<" {
+			operands = append(operands, l.objectFrom(tok))
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) > 0 {
+				if name, ok := operands[0].(pdfName); ok && fonts[name] != nil {
+					font = d.font(fonts[name])
+				}
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			t.newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				parts, _ := operands[len(operands)-1].([]any)
+				for _, part := range parts {
+					if n, ok := part.(float64); ok && n < wordSpacing {
+						t.space()
+					}
+					show(part)
+				}
+			}
+		case "Td", "TD":
+			if ty := number(operands, 1); ty != 0 {
+				y += ty
+				t.newline()
+			} else if number(operands, 0) > 0 {
+				t.space()
+			}
+		case "Tm":
+			if ty := number(operands, 5); ty != y {
+				y = ty
+				t.newline()
+			} else {
+				t.space()
+			}
+		case "T*":
+			t.newline()
+		case "ET":
+			t.space()
+		case "Do":
+			if len(operands) == 0 || depth >= maxFormDepth {
+				break
+			}
+			name, _ := operands[0].(pdfName)
+			form, ok := d.resolve(xobjects[name]).(*pdfStream)
+			if !ok || form.dict["Subtype"] != pdfName("Form") {
+				break
+			}
+			data, err := d.decode(form)
+			if err != nil {
+				break
+			}
+			formResources := d.dict(form.dict["Resources"])
+			if formResources == nil {
+				formResources = resources
+			}
+			d.showText(t, data, formResources, depth+1)
+		case "ID":
+			// The data of an inline image runs up to EI.
+			if end := pdfInlineImageEnd.FindIndex(content[l.pos:]); end != nil {
+				l.pos += end[1]
+			} else {
+				l.pos = len(content)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+var pdfInlineImageEnd = regexp.MustCompile(`\sEI(\s|$)`)
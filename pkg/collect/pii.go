@@ -0,0 +1,104 @@
+package collect
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// piiRule recognizes one kind of personal detail, replaced by mask.
+type piiRule struct {
+	mask    string
+	pattern *regexp.Regexp
+	// valid, if set, rejects matches that only look like the detail.
+	valid func(match string) bool
+}
+
+var piiRules = []piiRule{
+	{"[EMAIL]", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`), nil},
+	{"[PHONE]", regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{2,4}){1,4}\b|\(\d{3}\) ?\d{3}[ .-]\d{4}\b|\b\d{3}[.-]\d{3}[.-]\d{4}\b`), validPhone},
+	{"[IP]", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), validIP},
+	{"[IP]", regexp.MustCompile(`(?i)(?:\b[0-9a-f]{1,4}|:)(?::[0-9a-f]{0,4}){2,7}\b`), validIP},
+}
+
+// validPhone keeps numbers with as many digits as phone numbers have.
+func validPhone(match string) bool {
+	digits := 0
+	for _, c := range match {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// validIP keeps the addresses that belong to someone: not the loopback and
+// unspecified addresses, which say nothing about the data.
+func validIP(match string) bool {
+	ip := net.ParseIP(match)
+	return ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() && strings.ContainsAny(match, "0123456789")
+}
+
+// piiMatch is the location of a suspected personal detail in a file.
+type piiMatch struct {
+	start, end int
+	mask       string
+}
+
+// findPII returns the email addresses, phone numbers and IP addresses in
+// text, in order and without overlaps. A match running on into more digits
+// and dots, such as a version number, is not an address.
+func findPII(text string) []piiMatch {
+	var matches []piiMatch
+	for _, rule := range piiRules {
+		for _, loc := range rule.pattern.FindAllStringIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if rule.mask != "[EMAIL]" && continuesNumber(text, start, end) {
+				continue
+			}
+			// In x+1234567 the plus is an operator.
+			if rule.mask == "[PHONE]" && start > 0 && isWordByte(text[start-1]) {
+				continue
+			}
+			if rule.valid == nil || rule.valid(text[start:end]) {
+				matches = append(matches, piiMatch{start: start, end: end, mask: rule.mask})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	var kept []piiMatch
+	for _, m := range matches {
+		if len(kept) > 0 && m.start < kept[len(kept)-1].end {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// continuesNumber reports whether the match at text[start:end] is part of
+// a longer dotted number, such as 1.2.3.4.5.
+func continuesNumber(text string, start, end int) bool {
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+	return start > 1 && text[start-1] == '.' && digit(text[start-2]) ||
+		end+1 < len(text) && text[end] == '.' && digit(text[end+1])
+}
+
+// isWordByte reports whether c ends an operand: a word or a parenthesis.
+func isWordByte(c byte) bool {
+	return c == '_' || c == ')' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// redactPII replaces each match in text with its mask.
+func redactPII(text string, matches []piiMatch) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.start])
+		b.WriteString(m.mask)
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
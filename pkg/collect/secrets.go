@@ -0,0 +1,115 @@
+package collect
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Modes accepted in Collector.Secrets.
+const (
+	SecretsRedact = "redact"
+	SecretsSkip   = "skip"
+	SecretsFail   = "fail"
+)
+
+// secretRule recognizes one kind of credential. The secret is the whole
+// match, or the first submatch if the pattern has one.
+type secretRule struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+var secretRules = []secretRule{
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{50,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{24,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"API key", regexp.MustCompile(`\bsk-(?:ant-|proj-)?[A-Za-z0-9_-]{32,}`)},
+	{"JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+}
+
+// assignedSecret matches a value assigned to a key that names a credential,
+// as in `API_TOKEN=...` or `"password": "..."`. Such values are only taken
+// for secrets when they look random, so placeholders and variable names are
+// left alone.
+var assignedSecret = regexp.MustCompile(`(?i)(?:api[_-]?key|secret|token|passw(?:or)?d|credential)s?["']?\s*[:=]\s*["']?([A-Za-z0-9/+_=.\-]{16,})`)
+
+// minSecretEntropy is the Shannon entropy, in bits per character, above
+// which an assigned value is considered random. English identifiers stay
+// well below it, while base64 and hex keys of this length exceed it.
+const minSecretEntropy = 3.5
+
+// secretMatch is the location of a suspected secret in a file.
+type secretMatch struct {
+	start, end int
+	kind       string
+	line       int
+}
+
+// findSecrets returns the suspected secrets in text, in order and without
+// overlaps.
+func findSecrets(text string) []secretMatch {
+	var matches []secretMatch
+	add := func(kind string, loc []int) {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		matches = append(matches, secretMatch{start: start, end: end, kind: kind})
+	}
+	for _, rule := range secretRules {
+		for _, loc := range rule.pattern.FindAllStringSubmatchIndex(text, -1) {
+			add(rule.kind, loc)
+		}
+	}
+	for _, loc := range assignedSecret.FindAllStringSubmatchIndex(text, -1) {
+		if value := text[loc[2]:loc[3]]; strings.ContainsAny(value, "0123456789") && entropy(value) >= minSecretEntropy {
+			add("credential", loc)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	var kept []secretMatch
+	for _, m := range matches {
+		if len(kept) > 0 && m.start < kept[len(kept)-1].end {
+			continue
+		}
+		m.line = strings.Count(text[:m.start], "\n") + 1
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// redactSecrets replaces each match in text with [REDACTED].
+func redactSecrets(text string, matches []secretMatch) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.start])
+		b.WriteString("[REDACTED]")
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	bits := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
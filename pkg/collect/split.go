@@ -0,0 +1,125 @@
+package collect
+
+// Part is one self-contained document of a split collection.
+type Part struct {
+	Output string
+	Files  int
+	Tokens int
+}
+
+// split divides the collected files, in walk order, into the parts requested
+// by Chunks or ChunkTokens. A file is never divided, so a file larger than
+// ChunkTokens gets a part of its own.
+func (c *Collector) split(result Result, collected []fileResult, f formatter, tokenizer Tokenizer) ([]Part, error) {
+	if len(collected) == 0 {
+		return nil, nil
+	}
+
+	// The sections follow the contents, so they only go into the last part.
+	sections := f.sections
+	f.sections = nil
+	sectionTokens := tokenizer.Count(formatter{format: f.format, sections: sections}.renderSections())
+
+	// Every part repeats the document skeleton and its header; on top of
+	// that, each file costs its content and its line in the file tree. An
+	// HTML page is for people, so its markup is not counted.
+	skeleton, err := f.document(Result{Root: result.Root}, "")
+	if err != nil {
+		return nil, err
+	}
+	if f.format == FormatHTML {
+		skeleton = ""
+	}
+	// The prompt goes into the first and last parts, but is counted in each
+	// so that every part stays within ChunkTokens.
+	promptTokens, err := c.promptTokens(tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	overhead := tokenizer.Count(skeleton) + tokenizer.Count(f.partHeader(len(collected), len(collected))) + c.wrapTokens(tokenizer) + promptTokens
+	costs := make([]int, len(collected))
+	total := 0
+	for i, file := range collected {
+		costs[i] = file.stat.Tokens + tokenizer.Count(file.stat.Path+"\n")
+		total += costs[i]
+	}
+
+	var groups [][]fileResult
+	if c.ChunkTokens > 0 {
+		size := overhead
+		for i, file := range collected {
+			if len(groups) == 0 || size+costs[i] > c.ChunkTokens {
+				groups = append(groups, nil)
+				size = overhead
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], file)
+			size += costs[i]
+		}
+	} else {
+		// Assign each file to the part its midpoint falls into, so the
+		// parts are close in size without reordering anything.
+		groups = make([][]fileResult, c.Chunks)
+		before := 0
+		for i, file := range collected {
+			k := min(c.Chunks-1, (before+costs[i]/2)*c.Chunks/max(total, 1))
+			groups[k] = append(groups[k], file)
+			before += costs[i]
+		}
+		nonEmpty := groups[:0]
+		for _, group := range groups {
+			if len(group) > 0 {
+				nonEmpty = append(nonEmpty, group)
+			}
+		}
+		groups = nonEmpty
+	}
+
+	parts := make([]Part, len(groups))
+	for k, group := range groups {
+		partResult := Result{Root: result.Root, TotalTokens: overhead - promptTokens}
+		if k == len(groups)-1 {
+			f.sections = sections
+			partResult.TotalTokens += sectionTokens
+		}
+		var contents string
+		for _, file := range group {
+			contents += file.content
+			partResult.Files = append(partResult.Files, file.stat)
+			partResult.TotalTokens += file.stat.Tokens
+		}
+		partResult.FileTree = buildFileTree(f.named(partResult.Files), c.Tree, c.TreeTokens)
+
+		var document string
+		if f.format == FormatJSON {
+			if k == 0 {
+				// The first part reports the skipped files once.
+				for _, stat := range result.Files {
+					if stat.Status != StatusCollected {
+						partResult.Files = append(partResult.Files, stat)
+					}
+				}
+			}
+			doc := f.jsonDocument(partResult)
+			doc.Part, doc.Parts = k+1, len(groups)
+			if document, err = encodeJSONDocument(doc); err != nil {
+				return nil, err
+			}
+		} else {
+			if document, err = f.document(partResult, contents); err != nil {
+				return nil, err
+			}
+			document = f.partHeader(k+1, len(groups)) + document
+		}
+		if k == 0 {
+			document = c.prependText() + document
+			partResult.TotalTokens += tokenizer.Count(c.prependText())
+		}
+		if k == len(groups)-1 {
+			appended := c.appendText(document)
+			document += appended
+			partResult.TotalTokens += tokenizer.Count(appended)
+		}
+		parts[k] = Part{Output: c.wrap(document), Files: len(group), Tokens: partResult.TotalTokens}
+	}
+	return parts, nil
+}
@@ -0,0 +1,338 @@
+package collect
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commentSyntax describes how a language writes comments and the strings
+// that may contain comment markers without starting one.
+type commentSyntax struct {
+	// line lists the markers of comments running to the end of the line.
+	line []string
+	// blockStart and blockEnd delimit comments that may span lines.
+	blockStart, blockEnd string
+	// quotes lists the characters that open a string.
+	quotes string
+	// triple means tripled quotes open strings that span lines, as in
+	// Python.
+	triple bool
+	// lifetimes means a single quote only starts a character literal if it
+	// closes right after, as in Rust.
+	lifetimes bool
+}
+
+var (
+	cComments      = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	jsComments     = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	rustComments   = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`, lifetimes: true}
+	cssComments    = commentSyntax{blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	hashComments   = commentSyntax{line: []string{"#"}, quotes: `"'`}
+	pythonComments = commentSyntax{line: []string{"#"}, quotes: `"'`, triple: true}
+	sqlComments    = commentSyntax{line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	xmlComments    = commentSyntax{blockStart: "<!--", blockEnd: "-->", quotes: `"`}
+)
+
+// commentSyntaxes maps the languages of languageForPath to their comment
+// syntax. Languages missing here keep their comments.
+var commentSyntaxes = map[string]commentSyntax{
+	"Go":               jsComments,
+	"JavaScript":       jsComments,
+	"TypeScript":       jsComments,
+	"Java":             cComments,
+	"Kotlin":           cComments,
+	"Scala":            cComments,
+	"Rust":             rustComments,
+	"C":                cComments,
+	"C++":              cComments,
+	"C#":               cComments,
+	"Swift":            cComments,
+	"Objective-C":      cComments,
+	"PHP":              {line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`},
+	"Dart":             cComments,
+	"Protocol Buffers": cComments,
+	"SCSS":             cComments,
+	"Less":             cComments,
+	"CSS":              cssComments,
+	"HCL":              {line: []string{"#", "//"}, blockStart: "/*", blockEnd: "*/", quotes: `"`},
+	"Python":           pythonComments,
+	"Ruby":             hashComments,
+	"Perl":             hashComments,
+	"R":                hashComments,
+	"Elixir":           hashComments,
+	"Shell":            hashComments,
+	"YAML":             hashComments,
+	"TOML":             hashComments,
+	"Dockerfile":       hashComments,
+	"Makefile":         hashComments,
+	"PowerShell":       {line: []string{"#"}, blockStart: "<#", blockEnd: "#>", quotes: `"'`},
+	"SQL":              sqlComments,
+	"Lua":              {line: []string{"--"}, blockStart: "--[[", blockEnd: "]]", quotes: `"'`},
+	"Haskell":          {line: []string{"--"}, blockStart: "{-", blockEnd: "-}", quotes: `"`},
+	"Erlang":           {line: []string{"%"}, quotes: `"`},
+	"Clojure":          {line: []string{";"}, quotes: `"`},
+	"HTML":             xmlComments,
+	"XML":              xmlComments,
+}
+
+// keptComment reports whether a comment is kept despite stripping because
+// removing it would change what the file means: a shebang, or a Go build
+// constraint or compiler directive.
+func keptComment(comment string, first bool) bool {
+	return (first && strings.HasPrefix(comment, "#!")) ||
+		strings.HasPrefix(comment, "//go:") || strings.HasPrefix(comment, "// +build")
+}
+
+// stripComments removes the comments from the source of a file in language,
+// dropping the lines that held nothing else. It returns src unchanged for
+// languages without a known comment syntax. Like outlineBraces it is lexical:
+// it skips strings so that "//" in a URL survives, but rarer constructs such
+// as heredocs can fool it.
+func stripComments(language, src string) string {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return src
+	}
+	var out strings.Builder
+	// stripped records the lines a comment was removed from. Newlines inside
+	// block comments are kept, so the lines of out match those of src.
+	stripped := map[int]bool{}
+	line := 0
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		if syntax.blockStart != "" && strings.HasPrefix(rest, syntax.blockStart) {
+			end := strings.Index(rest[len(syntax.blockStart):], syntax.blockEnd)
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += len(syntax.blockStart) + len(syntax.blockEnd)
+			}
+			for _, ch := range rest[:end] {
+				if ch == '\n' {
+					stripped[line] = true
+					out.WriteByte('\n')
+					line++
+				}
+			}
+			stripped[line] = true
+			i += end
+			// x /* c */ + y leaves x + y, not x  + y.
+			if i < len(src) && src[i] == ' ' && strings.HasSuffix(out.String(), " ") {
+				i++
+			}
+			continue
+		}
+		if lineComment(syntax, rest, i == 0 || strings.IndexByte(" \t\n", src[i-1]) >= 0) {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			if keptComment(rest[:end], line == 0) {
+				out.WriteString(rest[:end])
+			} else {
+				stripped[line] = true
+			}
+			i += end
+			continue
+		}
+
+		ch := src[i]
+		if strings.IndexByte(syntax.quotes, ch) >= 0 {
+			end := 0
+			switch {
+			case syntax.triple && (strings.HasPrefix(rest, `"""`) || strings.HasPrefix(rest, "'''")):
+				if close := strings.Index(rest[3:], rest[:3]); close >= 0 {
+					end = close + 6
+				} else {
+					end = len(rest)
+				}
+			case ch == '\'' && syntax.lifetimes:
+				end = len(rustChar.FindString(rest))
+			default:
+				end = stringEnd(rest)
+			}
+			if end > 0 {
+				out.WriteString(rest[:end])
+				line += strings.Count(rest[:end], "\n")
+				i += end
+				continue
+			}
+		}
+
+		out.WriteByte(ch)
+		if ch == '\n' {
+			line++
+		}
+		i++
+	}
+
+	var kept []string
+	for i, text := range strings.Split(out.String(), "\n") {
+		if stripped[i] {
+			text = strings.TrimRight(text, " \t")
+			if text == "" {
+				continue
+			}
+		}
+		kept = append(kept, text)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// lineComment reports whether s starts with one of the line comment markers
+// of syntax. A marker that is also used inside words, as # is in shell
+// variables and URLs, only counts at the start of a word.
+func lineComment(syntax commentSyntax, s string, wordStart bool) bool {
+	for _, marker := range syntax.line {
+		if strings.HasPrefix(s, marker) && (marker != "#" || wordStart) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripBlankLines removes the lines of text that are empty or hold only
+// whitespace.
+func stripBlankLines(text string) string {
+	var kept []string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// licenseMarkers are phrases of the notices that open license headers, in
+// lower case. A comment at the top of a file without any is documentation.
+var licenseMarkers = []string{"copyright", "spdx-license-identifier", "licensed under", "permission is hereby granted", "all rights reserved"}
+
+// licenseNames identifies a license by a phrase of its header, in lower
+// case, checked in order.
+var licenseNames = []struct{ phrase, name string }{
+	{"apache license", "Apache-2.0"},
+	{"permission is hereby granted, free of charge", "MIT"},
+	{"mozilla public license", "MPL-2.0"},
+	{"gnu affero general public license", "AGPL"},
+	{"gnu lesser general public license", "LGPL"},
+	{"gnu general public license", "GPL"},
+	{"redistribution and use in source and binary forms", "BSD"},
+	{"bsd-style license", "BSD"},
+	{"eclipse public license", "EPL"},
+}
+
+// stripLicenseHeader removes the license header from the top of the source
+// of a file in language: the first comment, if it holds a copyright or
+// license notice, and the blank lines after it. A shebang or encoding line
+// above it is kept. It returns the license the header names, by its SPDX
+// identifier where there is one, "other" if it names none, and "" with src
+// unchanged if there is no header.
+func stripLicenseHeader(language, src string) (string, string) {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return src, ""
+	}
+	lines := strings.SplitAfter(src, "\n")
+	start := 0
+	for start < len(lines) {
+		line := strings.TrimSpace(lines[start])
+		if !(start == 0 && strings.HasPrefix(line, "#!")) && !strings.Contains(line, "-*- coding") && !strings.HasPrefix(line, "<?") {
+			break
+		}
+		start++
+	}
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+
+	end := start
+	if rest := strings.Join(lines[start:], ""); syntax.blockStart != "" && strings.HasPrefix(strings.TrimSpace(rest), syntax.blockStart) {
+		opening := strings.Index(rest, syntax.blockStart) + len(syntax.blockStart)
+		closing := strings.Index(rest[opening:], syntax.blockEnd)
+		if closing < 0 {
+			return src, ""
+		}
+		closing += opening + len(syntax.blockEnd)
+		// Code after the end of the comment on its line is not part of it.
+		line := strings.IndexByte(rest[closing:], '\n')
+		if line < 0 {
+			line = len(rest) - closing
+		}
+		if strings.TrimSpace(rest[closing:closing+line]) != "" {
+			return src, ""
+		}
+		end += strings.Count(rest[:closing+line], "\n") + 1
+		end = min(end, len(lines))
+	} else {
+		for end < len(lines) {
+			line := strings.TrimSpace(lines[end])
+			if !lineComment(syntax, line, true) || keptComment(line, end == 0) {
+				break
+			}
+			end++
+		}
+	}
+	if end == start {
+		return src, ""
+	}
+	header := strings.ToLower(strings.Join(lines[start:end], ""))
+	isLicense := false
+	for _, marker := range licenseMarkers {
+		isLicense = isLicense || strings.Contains(header, marker)
+	}
+	if !isLicense {
+		return src, ""
+	}
+
+	license := "other"
+	if at := strings.Index(header, "spdx-license-identifier:"); at >= 0 {
+		fields := strings.Fields(strings.Join(lines[start:end], "")[at+len("spdx-license-identifier:"):])
+		if len(fields) > 0 {
+			license = strings.TrimRight(fields[0], "*/->")
+		}
+	} else {
+		// Line breaks and comment markers can fall inside the phrases.
+		words := strings.Join(strings.Fields(strings.NewReplacer("*", " ", "#", " ", "//", " ", "--", " ").Replace(header)), " ")
+		for _, known := range licenseNames {
+			if strings.Contains(words, known.phrase) {
+				license = known.name
+				break
+			}
+		}
+	}
+	for end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+		end++
+	}
+	return strings.Join(lines[:start], "") + strings.Join(lines[end:], ""), license
+}
+
+// licenseNote describes the license headers StripLicenseHeaders removed
+// from the collected files, or returns "" if it removed none.
+func licenseNote(files []FileStat) string {
+	counts := map[string]int{}
+	total := 0
+	for _, stat := range files {
+		if stat.Status == StatusCollected && stat.License != "" {
+			counts[stat.License]++
+			total++
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	licenses := make([]string, 0, len(counts))
+	for license := range counts {
+		licenses = append(licenses, license)
+	}
+	sort.Slice(licenses, func(i, j int) bool {
+		if counts[licenses[i]] != counts[licenses[j]] {
+			return counts[licenses[i]] > counts[licenses[j]]
+		}
+		return licenses[i] < licenses[j]
+	})
+	for i, license := range licenses {
+		licenses[i] = fmt.Sprintf("%s (%d)", license, counts[license])
+	}
+	return fmt.Sprintf("The license header at the top of %d files was removed: %s.", total, strings.Join(licenses, ", "))
+}
@@ -0,0 +1,202 @@
+package collect
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// LineRange selects the lines Start to End of a file, counting from 1. An
+// End of 0 runs to the end of the file.
+type LineRange struct {
+	Start, End int
+}
+
+// ParseLineRange parses a range written "100-250", "100-" or "100".
+func ParseLineRange(s string) (LineRange, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 1 {
+		return LineRange{}, fmt.Errorf("invalid line range %q", s)
+	}
+	r := LineRange{Start: start, End: start}
+	if isRange {
+		r.End = 0
+		if last != "" {
+			if r.End, err = strconv.Atoi(last); err != nil || r.End < start {
+				return LineRange{}, fmt.Errorf("invalid line range %q", s)
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r LineRange) String() string {
+	switch r.End {
+	case r.Start:
+		return strconv.Itoa(r.Start)
+	case 0:
+		return fmt.Sprintf("%d-", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// selectLines keeps the lines of text within ranges, which are sorted and
+// do not overlap, with a marker where lines in between were left out. It
+// returns the original number of every line kept, 0 for the markers.
+func selectLines(text string, ranges []LineRange) (string, []int) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var b strings.Builder
+	var numbers []int
+	for i, r := range ranges {
+		end := r.End
+		if end == 0 || end > len(lines) {
+			end = len(lines)
+		}
+		if r.Start > end {
+			continue
+		}
+		if i > 0 {
+			b.WriteString("[...]\n")
+			numbers = append(numbers, 0)
+		}
+		for n := r.Start; n <= end; n++ {
+			line := lines[n-1]
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			b.WriteString(line)
+			numbers = append(numbers, n)
+		}
+	}
+	return b.String(), numbers
+}
+
+// findSymbols returns the line ranges of the top-level declarations of a Go
+// file that match one of symbols, doc comments included. A symbol matches a
+// declaration by name ("Handle", "Server.Handle" for a method) or as the
+// start of its source, compared with whitespace collapsed
+// ("func (s *Server) Handle"). Files in other languages declare nothing.
+func findSymbols(p, src string, symbols []string) []LineRange {
+	if strings.ToLower(path.Ext(p)) != ".go" || len(symbols) == 0 {
+		return nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, p, src, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	normalized := make([]string, len(symbols))
+	for i, symbol := range symbols {
+		normalized[i] = strings.Join(strings.Fields(symbol), " ")
+	}
+	matches := func(node ast.Node, names ...string) bool {
+		start, end := fset.Position(node.Pos()).Offset, fset.Position(node.End()).Offset
+		source := strings.Join(strings.Fields(src[start:end]), " ")
+		for _, symbol := range normalized {
+			// "func Handle" matches func Handle(...) but not func HandleAll.
+			if strings.HasPrefix(source, symbol) && !isIdentByte(source, len(symbol)) {
+				return true
+			}
+			for _, name := range names {
+				if name == symbol {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	lineRange := func(node ast.Node, doc *ast.CommentGroup) LineRange {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return LineRange{Start: fset.Position(start).Line, End: fset.Position(node.End()).Line}
+	}
+
+	var ranges []LineRange
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			names := []string{decl.Name.Name}
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				names = append(names, receiverName(decl.Recv.List[0].Type)+"."+decl.Name.Name)
+			}
+			if matches(decl, names...) {
+				ranges = append(ranges, lineRange(decl, decl.Doc))
+			}
+		case *ast.GenDecl:
+			if !decl.Lparen.IsValid() {
+				if matches(decl, specNames(decl.Specs[0])...) {
+					ranges = append(ranges, lineRange(decl, decl.Doc))
+				}
+				continue
+			}
+			// In a group, only the matching specs are kept.
+			for _, spec := range decl.Specs {
+				doc := specDoc(spec)
+				if matches(spec, specNames(spec)...) {
+					ranges = append(ranges, lineRange(spec, doc))
+				}
+			}
+		}
+	}
+	return ranges
+}
+
+// isIdentByte reports whether s[i] can continue an identifier.
+func isIdentByte(s string, i int) bool {
+	if i >= len(s) {
+		return false
+	}
+	b := s[i]
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// receiverName returns the type name of a method receiver, without the
+// pointer or type parameters.
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// specNames returns the names a type, constant or variable spec declares.
+func specNames(spec ast.Spec) []string {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{spec.Name.Name}
+	case *ast.ValueSpec:
+		var names []string
+		for _, name := range spec.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Doc
+	case *ast.ValueSpec:
+		return spec.Doc
+	}
+	return nil
+}
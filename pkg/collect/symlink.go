@@ -0,0 +1,99 @@
+package collect
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LinkFS is a file system that can tell where its symbolic links point, so
+// that Collect can keep followed links from leading outside it. DirFS
+// returns one.
+type LinkFS interface {
+	fs.FS
+	// ReadLink returns the destination of the symbolic link name, as a
+	// slash-separated path relative to the link's directory, or an
+	// absolute path if it lies outside the file system. It fails for
+	// files that are not links.
+	ReadLink(name string) (string, error)
+}
+
+// maxLinkHops bounds how many links resolveLink follows, as the operating
+// system does, so that links pointing at each other end.
+const maxLinkHops = 40
+
+var errOutsideRoot = errors.New("points outside the root")
+
+// resolveLink returns the path within fsys that p refers to once every
+// symbolic link along it is followed, or errOutsideRoot if one of them
+// leads out of fsys.
+func resolveLink(fsys LinkFS, p string) (string, error) {
+	resolved, remaining := ".", strings.Split(p, "/")
+	for hops := 0; len(remaining) > 0; {
+		next := path.Join(resolved, remaining[0])
+		remaining = remaining[1:]
+		target, err := fsys.ReadLink(next)
+		if err != nil {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxLinkHops {
+			return "", errors.New("too many levels of symbolic links")
+		}
+		if path.IsAbs(target) || filepath.IsAbs(filepath.FromSlash(target)) {
+			return "", errOutsideRoot
+		}
+		joined := path.Join(resolved, target)
+		if joined == ".." || strings.HasPrefix(joined, "../") {
+			return "", errOutsideRoot
+		}
+		resolved, remaining = ".", append(strings.Split(joined, "/"), remaining...)
+	}
+	return resolved, nil
+}
+
+// DirFS returns the directory dir as a file system, like os.DirFS, that
+// also implements LinkFS.
+func DirFS(dir string) fs.FS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (f dirFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(f.FS, name) }
+func (f dirFS) ReadFile(name string) ([]byte, error)       { return fs.ReadFile(f.FS, name) }
+func (f dirFS) Stat(name string) (fs.FileInfo, error)      { return fs.Stat(f.FS, name) }
+
+func (f dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := os.Readlink(filepath.Join(f.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(target) {
+		// Absolute links into the directory are made relative, so that
+		// they count as inside it.
+		dir, err := filepath.Abs(filepath.Join(f.dir, filepath.FromSlash(path.Dir(name))))
+		if err != nil {
+			return "", err
+		}
+		root, err := filepath.Abs(f.dir)
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(root, target); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if rel, err := filepath.Rel(dir, target); err == nil {
+				return filepath.ToSlash(rel), nil
+			}
+		}
+	}
+	return filepath.ToSlash(target), nil
+}
@@ -0,0 +1,131 @@
+package collect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenCacheMinBytes is the size below which texts are counted afresh:
+	// tokenizing them costs about as much as hashing and storing them.
+	tokenCacheMinBytes = 1024
+	// tokenCacheMaxAge is how long counts unused by any run are kept.
+	tokenCacheMaxAge = 30 * 24 * time.Hour
+)
+
+// TokenCache is a Tokenizer that remembers the counts of another by the
+// SHA-256 hash of the text, and keeps them in a file between runs, so that
+// repeated collections of a large tree, and every -watch iteration, only
+// tokenize the files that changed. Since the key is the text actually
+// counted, a file collected with different options is counted again. It is
+// safe for concurrent use.
+type TokenCache struct {
+	tokenizer Tokenizer
+	path      string
+
+	mu      sync.Mutex
+	entries map[string]tokenCacheEntry
+	dirty   bool
+}
+
+type tokenCacheEntry struct {
+	Tokens int   `json:"tokens"`
+	Used   int64 `json:"used"` // Unix time it was last counted, to within a day
+}
+
+// OpenTokenCache returns a TokenCache for tokenizer backed by the file at path,
+// which need not exist yet. path should be specific to the tokenizer's
+// encoding. A file that cannot be parsed is started over.
+func OpenTokenCache(tokenizer Tokenizer, path string) (*TokenCache, error) {
+	cache := &TokenCache{tokenizer: tokenizer, path: path, entries: make(map[string]tokenCacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if json.Unmarshal(data, &cache.entries) != nil {
+		cache.entries = make(map[string]tokenCacheEntry)
+	}
+	return cache, nil
+}
+
+func (c *TokenCache) Count(text string) int {
+	if len(text) < tokenCacheMinBytes {
+		return c.tokenizer.Count(text)
+	}
+	sum := sha256.Sum256([]byte(text))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now().Unix()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		// Refreshing the time daily is enough for pruning, and leaves an
+		// unchanged tree with nothing to save.
+		if now-entry.Used > 24*60*60 {
+			entry.Used = now
+			c.entries[key] = entry
+			c.dirty = true
+		}
+		c.mu.Unlock()
+		return entry.Tokens
+	}
+	c.mu.Unlock()
+
+	tokens := c.tokenizer.Count(text)
+	c.mu.Lock()
+	c.entries[key] = tokenCacheEntry{Tokens: tokens, Used: now}
+	c.dirty = true
+	c.mu.Unlock()
+	return tokens
+}
+
+// Save writes the counts to the cache file if any changed, leaving out those
+// no run has used for a month. The file is replaced in one step, so that
+// concurrent runs never read half of it.
+func (c *TokenCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	cutoff := time.Now().Add(-tokenCacheMaxAge).Unix()
+	for key, entry := range c.entries {
+		if entry.Used < cutoff {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	c.dirty = false
+	return nil
+}
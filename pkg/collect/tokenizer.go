@@ -0,0 +1,88 @@
+package collect
+
+import (
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// The encodings are embedded in the binary rather than downloaded on first
+// use, so counting works offline and in sandboxed CI.
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// Tokenizer counts the tokens a model sees for a piece of text.
+type Tokenizer interface {
+	Count(text string) int
+}
+
+type tiktokenTokenizer struct {
+	encoding *tiktoken.Tiktoken
+}
+
+func (t tiktokenTokenizer) Count(text string) int {
+	return len(t.encoding.Encode(text, nil, nil))
+}
+
+// ApproximateTokenizer estimates tokens from the byte and word counts: one
+// per four bytes plus one per eight words, which lands within a few percent
+// of o200k_base on typical source code and prose. It is used for models whose
+// tokenizer is not published, and when loading an encoding is not worth it.
+type ApproximateTokenizer struct{}
+
+func (ApproximateTokenizer) Count(text string) int {
+	return (len(text)+3)/4 + len(strings.Fields(text))/8
+}
+
+// encodings lists the tiktoken encodings that can be named directly.
+var encodings = []string{
+	tiktoken.MODEL_O200K_BASE,
+	tiktoken.MODEL_CL100K_BASE,
+	tiktoken.MODEL_P50K_BASE,
+	tiktoken.MODEL_P50K_EDIT,
+	tiktoken.MODEL_R50K_BASE,
+}
+
+// o200kModelPrefixes are OpenAI models newer than the tiktoken-go tables,
+// which all use the o200k_base encoding.
+var o200kModelPrefixes = []string{"gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+// NewTokenizer returns the Tokenizer for model, which is an OpenAI model name
+// (gpt-4o, gpt-4, ...), a tiktoken encoding name (o200k_base, cl100k_base,
+// ...) or "approximate". Other models have no published tokenizer and get an
+// ApproximateTokenizer.
+func NewTokenizer(model string) (Tokenizer, error) {
+	if model == "approximate" {
+		return ApproximateTokenizer{}, nil
+	}
+	encoding := ""
+	for _, name := range encodings {
+		if model == name {
+			encoding = name
+		}
+	}
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			encoding = tiktoken.MODEL_O200K_BASE
+		}
+	}
+	if encoding == "" {
+		encoding = tiktoken.MODEL_TO_ENCODING[model]
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if encoding == "" && strings.HasPrefix(model, prefix) {
+			encoding = name
+		}
+	}
+	if encoding == "" {
+		return ApproximateTokenizer{}, nil
+	}
+
+	tke, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return tiktokenTokenizer{encoding: tke}, nil
+}
@@ -0,0 +1,106 @@
+package collect
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// File tree layouts accepted in Collector.Tree.
+const (
+	TreeFlat = "flat"
+	TreeTree = "tree"
+	TreeNone = "none"
+)
+
+// treeNode is a file or directory of a rendered file tree.
+type treeNode struct {
+	name     string
+	tokens   int
+	counted  bool
+	children []*treeNode
+	dirs     map[string]*treeNode
+}
+
+// buildFileTree lists the files in the chosen layout: one path per line in
+// walk order for TreeFlat, nested directories drawn with box characters for
+// TreeTree, and nothing for TreeNone. With tokens, collected files carry
+// their token counts and directories the totals below them.
+func buildFileTree(files []FileStat, layout string, tokens bool) string {
+	var builder strings.Builder
+	switch layout {
+	case TreeNone:
+	case TreeTree:
+		root := &treeNode{dirs: map[string]*treeNode{}}
+		for _, stat := range files {
+			node := root
+			parts := strings.Split(stat.Path, "/")
+			for _, dir := range parts[:len(parts)-1] {
+				child, ok := node.dirs[dir]
+				if !ok {
+					child = &treeNode{name: dir, dirs: map[string]*treeNode{}}
+					node.dirs[dir] = child
+					node.children = append(node.children, child)
+				}
+				node = child
+			}
+			node.children = append(node.children, &treeNode{name: path.Base(stat.Path), tokens: stat.Tokens, counted: stat.Status == StatusCollected})
+		}
+		root.total()
+		root.render(&builder, "", tokens)
+	default:
+		for _, stat := range files {
+			builder.WriteString(stat.Path)
+			if tokens && stat.Status == StatusCollected {
+				fmt.Fprintf(&builder, " (%d tokens)", stat.Tokens)
+			}
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+// total sums the tokens of the collected files below a directory.
+func (n *treeNode) total() {
+	if n.dirs == nil {
+		return
+	}
+	n.tokens, n.counted = 0, true
+	for _, child := range n.children {
+		child.total()
+		if child.counted {
+			n.tokens += child.tokens
+		}
+	}
+}
+
+// render writes the children of n, directories first, each prefixed with
+// the guides of the levels above it.
+func (n *treeNode) render(b *strings.Builder, prefix string, tokens bool) {
+	sort.SliceStable(n.children, func(i, j int) bool {
+		a, c := n.children[i], n.children[j]
+		if (a.dirs != nil) != (c.dirs != nil) {
+			return a.dirs != nil
+		}
+		return a.name < c.name
+	})
+	for i, child := range n.children {
+		branch, guide := "├── ", "│   "
+		if i == len(n.children)-1 {
+			branch, guide = "└── ", "    "
+		}
+		name := child.name
+		if child.dirs != nil {
+			name += "/"
+		}
+		b.WriteString(prefix + branch + name)
+		if tokens && child.counted {
+			fmt.Fprintf(b, " (%d tokens)", child.tokens)
+		}
+		b.WriteString("\n")
+		if child.dirs != nil {
+			child.render(b, prefix+guide, tokens)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package collect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Truncation strategies accepted in Collector.Truncate.
+const (
+	TruncateHead      = "head"
+	TruncateTail      = "tail"
+	TruncateHeadTail  = "head-tail"
+	TruncateMiddleOut = "middle-out"
+)
+
+// minTruncatedTokens is the least room left in the budget that is worth
+// filling with part of a file; with less, the file is skipped.
+const minTruncatedTokens = 100
+
+// truncate cuts text down to at most limit tokens at line boundaries, in
+// the given strategy, and puts a marker where lines were left out:
+//
+//   - head keeps the first lines;
+//   - tail keeps the last lines;
+//   - head-tail splits the limit evenly between the first and last lines;
+//   - middle-out keeps as many lines from either end, so the cut is
+//     centered on the middle of the file.
+//
+// Lines are counted on their own, which can differ slightly from the count
+// of the whole. It reports false if not even one line fits.
+func truncate(text, strategy string, limit int, tokenizer Tokenizer) (string, bool) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	limit -= tokenizer.Count(truncationMarker(len(lines)))
+	costs := make([]int, len(lines))
+	for i, line := range lines {
+		costs[i] = tokenizer.Count(line)
+	}
+
+	head, tail, used := 0, 0, 0
+	takeHead := func(limit int) bool {
+		if head+tail < len(lines) && used+costs[head] <= limit {
+			used += costs[head]
+			head++
+			return true
+		}
+		return false
+	}
+	takeTail := func(limit int) bool {
+		if i := len(lines) - 1 - tail; head+tail < len(lines) && used+costs[i] <= limit {
+			used += costs[i]
+			tail++
+			return true
+		}
+		return false
+	}
+	switch strategy {
+	case TruncateHead:
+		for takeHead(limit) {
+		}
+	case TruncateTail:
+		for takeTail(limit) {
+		}
+	case TruncateHeadTail:
+		for takeHead(limit / 2) {
+		}
+		for takeTail(limit) {
+		}
+	case TruncateMiddleOut:
+		for {
+			tookHead := takeHead(limit)
+			if !takeTail(limit) && !tookHead {
+				break
+			}
+		}
+	}
+	if head+tail == len(lines) {
+		return text, true
+	}
+	if head+tail == 0 {
+		return "", false
+	}
+
+	var b strings.Builder
+	for _, line := range lines[:head] {
+		b.WriteString(line)
+	}
+	b.WriteString(truncationMarker(len(lines) - head - tail))
+	for _, line := range lines[len(lines)-tail:] {
+		b.WriteString(line)
+	}
+	return b.String(), true
+}
+
+// byteCounter measures text in bytes, for truncating to a file size.
+type byteCounter struct{}
+
+func (byteCounter) Count(text string) int { return len(text) }
+
+// truncationMarker stands in for the lines truncate leaves out.
+func truncationMarker(lines int) string {
+	return fmt.Sprintf("[... %d lines truncated ...]\n", lines)
+}
+
+// truncateToFit truncates the text of a file so that, once formatted, it
+// takes at most room tokens. It returns the formatted content and its
+// tokens, or false if the file cannot be made to fit.
+func (c *Collector) truncateToFit(stat FileStat, text string, room int, f formatter, tokenizer Tokenizer) (string, int, bool) {
+	limit := room - tokenizer.Count(f.file(f.label(stat), stat.Language, ""))
+	// The lines are counted on their own, so the formatted file may still
+	// be a little over; a few tighter attempts settle it.
+	for attempt := 0; attempt < 3 && limit > 0; attempt++ {
+		truncated, ok := truncate(text, c.Truncate, limit, tokenizer)
+		if !ok {
+			return "", 0, false
+		}
+		content := f.file(f.label(stat), stat.Language, truncated)
+		tokens := tokenizer.Count(content)
+		if tokens <= room {
+			return content, tokens, true
+		}
+		limit -= tokens - room
+	}
+	return "", 0, false
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"collect/pkg/collect"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision served when the
+// client does not ask for one.
+const mcpProtocolVersion = "2024-11-05"
+
+// scope narrows the command line's collection for one request. Empty fields
+// keep what the flags chose.
+type scope struct {
+	Include   string `json:"include"`
+	Ignore    string `json:"ignore"`
+	MaxTokens *int   `json:"max_tokens"`
+}
+
+// apply returns a copy of c restricted to the scope: the include patterns
+// replace those of the command line, and the ignore patterns are added to
+// them. Collect adds to PathAliases, so the copy gets its own, starting from
+// the names read from -path-map, and requests can be served at once.
+func (s scope) apply(c *collect.Collector) *collect.Collector {
+	scoped := *c
+	scoped.PathAliases = maps.Clone(c.PathAliases)
+	if s.Include != "" {
+		scoped.Include = strings.Split(s.Include, ",")
+	}
+	if s.Ignore != "" {
+		scoped.Ignore = append(append([]string{}, c.Ignore...), strings.Split(s.Ignore, ",")...)
+	}
+	if s.MaxTokens != nil {
+		scoped.MaxTokens = *s.MaxTokens
+	}
+	return &scoped
+}
+
+// collectTree returns the file tree of everything in scope with token
+// counts, collected without a budget so that no file is left out of it.
+func collectTree(ctx context.Context, c *collect.Collector, fsys fs.FS) (string, error) {
+	scan := *c
+	scan.MaxTokens, scan.Chunks, scan.ChunkTokens = 0, 0, 0
+	scan.CountOnly, scan.TreeTokens = true, true
+	if scan.Tree == collect.TreeNone {
+		scan.Tree = collect.TreeTree
+	}
+	result, err := scan.Collect(ctx, fsys)
+	return result.FileTree, err
+}
+
+// mcpMessage is a JSON-RPC 2.0 request, notification or response.
+type mcpMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  any             `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTools describes the tools the server offers.
+var mcpTools = []map[string]any{
+	{
+		"name":        "collect_files",
+		"description": "Collect the contents of the repository's files into one document, formatted for a prompt and kept within a token budget.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"include":    map[string]any{"type": "string", "description": "Comma-separated extensions or glob patterns to include, e.g. \".go,docs/**/*.md\"."},
+				"ignore":     map[string]any{"type": "string", "description": "Comma-separated patterns to leave out, with .gitignore semantics."},
+				"max_tokens": map[string]any{"type": "integer", "description": "Token budget for the collection; 0 for no limit."},
+			},
+		},
+	},
+	{
+		"name":        "get_file_tree",
+		"description": "List the repository's files as a tree with the token count of each, to decide what to collect.",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"include": map[string]any{"type": "string", "description": "Comma-separated extensions or glob patterns to include."},
+				"ignore":  map[string]any{"type": "string", "description": "Comma-separated patterns to leave out."},
+			},
+		},
+	},
+}
+
+// saveTokenCache writes the token counts a request added to cache, if not
+// nil, as a server usually runs until it is killed.
+func saveTokenCache(cache *collect.TokenCache) {
+	if cache == nil {
+		return
+	}
+	if err := cache.Save(); err != nil {
+		fmt.Fprintf(logOutput, "Error saving token counts: %s\n", err)
+	}
+}
+
+// serveMCP answers Model Context Protocol requests read from r, one JSON
+// message per line, until r is closed. Every tool call collects afresh, so
+// the answers follow the files as they change.
+func serveMCP(r io.Reader, w io.Writer, c *collect.Collector, fsys fs.FS, cache *collect.TokenCache) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var request mcpMessage
+		if err := json.Unmarshal([]byte(line), &request); err != nil {
+			if err := encoder.Encode(mcpMessage{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{Code: rpcParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		// Notifications, such as notifications/initialized, get no answer.
+		if len(request.ID) == 0 {
+			continue
+		}
+		response := mcpMessage{JSONRPC: "2.0", ID: request.ID}
+		response.Result, response.Error = handleMCP(request, c, fsys)
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+		saveTokenCache(cache)
+	}
+	return scanner.Err()
+}
+
+// handleMCP answers a single request.
+func handleMCP(request mcpMessage, c *collect.Collector, fsys fs.FS) (any, *mcpError) {
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(request.Params, &params)
+		version := params.ProtocolVersion
+		if version == "" {
+			version = mcpProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "collect", "version": "1.0.0"},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments scope  `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &mcpError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		scoped := params.Arguments.apply(c)
+		var text string
+		var err error
+		switch params.Name {
+		case "collect_files":
+			var result collect.Result
+			result, err = scoped.Collect(context.Background(), fsys)
+			text = result.Output
+			if err == nil {
+				fmt.Fprintf(infoOutput, "Served %d tokens across %d files.\n", result.TotalTokens, result.TotalFiles)
+			}
+		case "get_file_tree":
+			text, err = collectTree(context.Background(), scoped, fsys)
+		default:
+			return nil, &mcpError{Code: rpcInvalidParams, Message: fmt.Sprintf("unknown tool %q", params.Name)}
+		}
+		// Tool failures are reported to the model rather than as protocol
+		// errors, so it can correct the call.
+		if err != nil {
+			return map[string]any{"content": []map[string]any{{"type": "text", "text": err.Error()}}, "isError": true}, nil
+		}
+		return map[string]any{"content": []map[string]any{{"type": "text", "text": text}}}, nil
+	}
+	return nil, &mcpError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method %q not found", request.Method)}
+}
+
+// serveHTTP serves the collection on addr until the server fails:
+// GET /context returns the formatted collection and GET /tree the file tree,
+// both narrowed by the include, ignore and max_tokens query parameters. An
+// address without a host, such as ":8080", only listens on localhost, since
+// the answers expose the files.
+func serveHTTP(addr string, c *collect.Collector, fsys fs.FS, cache *collect.TokenCache) error {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /context", func(w http.ResponseWriter, r *http.Request) {
+		s, err := queryScope(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := s.apply(c).Collect(r.Context(), fsys)
+		saveTokenCache(cache)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		contentType := "text/plain; charset=utf-8"
+		switch c.Format {
+		case collect.FormatJSON:
+			contentType = "application/json"
+		case collect.FormatHTML:
+			contentType = "text/html; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Collect-Tokens", strconv.Itoa(result.TotalTokens))
+		w.Header().Set("X-Collect-Files", strconv.Itoa(result.TotalFiles))
+		io.WriteString(w, result.Output)
+		fmt.Fprintf(infoOutput, "Served %d tokens across %d files.\n", result.TotalTokens, result.TotalFiles)
+	})
+	mux.HandleFunc("GET /tree", func(w http.ResponseWriter, r *http.Request) {
+		s, err := queryScope(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tree, err := collectTree(r.Context(), s.apply(c), fsys)
+		saveTokenCache(cache)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, tree)
+	})
+	fmt.Fprintf(infoOutput, "Serving %s on http://%s\n", c.Root, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// queryScope reads the scope of an HTTP request from its query parameters.
+func queryScope(r *http.Request) (scope, error) {
+	query := r.URL.Query()
+	s := scope{Include: query.Get("include"), Ignore: query.Get("ignore")}
+	if value := query.Get("max_tokens"); value != "" {
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens < 0 {
+			return s, fmt.Errorf("invalid max_tokens %q", value)
+		}
+		s.MaxTokens = &maxTokens
+	}
+	return s, nil
+}
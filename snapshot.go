@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"collect/pkg/collect"
+)
+
+// snapshotPath returns where the snapshot called name of the tree at root is
+// kept: in the user cache directory, apart from the snapshots of other trees,
+// so that saving one leaves the tree itself untouched.
+func snapshotPath(root, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid snapshot name %q", name)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(dir, "collect", "snapshots", hex.EncodeToString(sum[:8]), name+".json"), nil
+}
+
+// saveSnapshot records the collected files with their hashes and tokens.
+func saveSnapshot(path string, result collect.Result) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeManifest(path, result.Manifest())
+}
+
+// loadSnapshot reads a snapshot for collect snapshot diff, returning the
+// hashes to collect against and the files that no longer exist in fsys.
+func loadSnapshot(path, name string, fsys fs.FS) (map[string]string, []string, error) {
+	snapshot, err := readManifest(path)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("no snapshot %q here; save one with collect snapshot save %s", name, name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make(map[string]string, len(snapshot.Files))
+	var removed []string
+	for _, entry := range snapshot.Files {
+		hashes[entry.Path] = entry.Hash
+		if _, err := fs.Stat(fsys, entry.Path); err != nil {
+			removed = append(removed, entry.Path)
+		}
+	}
+	return hashes, removed, nil
+}
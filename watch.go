@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"collect/pkg/collect"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the tree has to stay quiet before collecting
+// again, so that saving several files or a checkout triggers a single run.
+const watchDebounce = 300 * time.Millisecond
+
+// watchChanges calls collectAgain whenever a file below the roots changes,
+// once the changes have settled. Paths the last collection filtered out and
+// the output file itself are not watched, or writing the output would
+// trigger the next run. It only returns on error.
+func watchChanges(baseDir string, roots []string, outputPath string, result collect.Result, collectAgain func() collect.Result) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	absRoots := make([]string, len(roots))
+	for i, root := range roots {
+		absRoots[i] = filepath.Join(absBase, filepath.FromSlash(root))
+	}
+	absOutput := ""
+	if outputPath != "" {
+		absOutput, _ = filepath.Abs(outputPath)
+	}
+
+	// fsnotify does not watch recursively, so every directory holding a
+	// candidate is watched on its own. The set is rebuilt after each run to
+	// pick up new directories.
+	watched := map[string]bool{}
+	filtered := map[string]bool{}
+	update := func(result collect.Result) {
+		filtered = map[string]bool{}
+		for _, stat := range result.Filtered {
+			filtered[stat.Path] = true
+		}
+		dirs := map[string]bool{}
+		for _, root := range roots {
+			dirs[root] = true
+			dirs[path.Dir(root)] = true
+		}
+		for _, stats := range [][]collect.FileStat{result.Files, result.Filtered} {
+			for _, stat := range stats {
+				for dir := path.Dir(stat.Path); !filtered[dir]; dir = path.Dir(dir) {
+					dirs[dir] = true
+					if dir == "." {
+						break
+					}
+				}
+			}
+		}
+		for dir := range dirs {
+			name := filepath.Join(absBase, filepath.FromSlash(dir))
+			if !watched[name] && watcher.Add(name) == nil {
+				watched[name] = true
+			}
+		}
+	}
+	relevant := func(name string) bool {
+		if name == absOutput {
+			return false
+		}
+		inRoots := false
+		for _, root := range absRoots {
+			inRoots = inRoots || isWithin(root, name)
+		}
+		if !inRoots {
+			return false
+		}
+		rel, err := filepath.Rel(absBase, name)
+		if err != nil {
+			return false
+		}
+		for p := filepath.ToSlash(rel); p != "."; p = path.Dir(p) {
+			if filtered[p] {
+				return false
+			}
+		}
+		return true
+	}
+
+	update(result)
+	var settled <-chan time.Time
+	changed := ""
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || !relevant(event.Name) {
+				continue
+			}
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !watched[event.Name] {
+				// A new directory has no candidates yet to be found by
+				// update, but files written into it are.
+				if watcher.Add(event.Name) == nil {
+					watched[event.Name] = true
+				}
+			}
+			if changed == "" {
+				changed, _ = filepath.Rel(absBase, event.Name)
+			}
+			settled = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-settled:
+			fmt.Fprintf(infoOutput, "\n%s changed, collecting again.\n", filepath.ToSlash(changed))
+			settled, changed = nil, ""
+			update(collectAgain())
+		}
+	}
+}